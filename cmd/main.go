@@ -1,11 +1,176 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+	"vpc_flowlogs_egress_analyzer/internal/budget"
 	"vpc_flowlogs_egress_analyzer/internal/config"
 	"vpc_flowlogs_egress_analyzer/internal/flow_logs"
+	"vpc_flowlogs_egress_analyzer/internal/ipRanges"
+	"vpc_flowlogs_egress_analyzer/internal/metrics"
+	"vpc_flowlogs_egress_analyzer/internal/notify"
+	"vpc_flowlogs_egress_analyzer/internal/report"
+	"vpc_flowlogs_egress_analyzer/internal/tui"
 )
 
 func main() {
 	config.LoadConfig()
-	flow_logs.Analyze()
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "update-ip-ranges":
+			if err := ipRanges.Update(ipRanges.FilePath()); err != nil {
+				log.Fatalf("CRITICAL: %v", err)
+			}
+			return
+		case "diff":
+			if len(os.Args) != 4 {
+				log.Fatalf("usage: %s diff <old result.json> <new result.json>", os.Args[0])
+			}
+			if err := runDiff(os.Args[2], os.Args[3]); err != nil {
+				log.Fatalf("CRITICAL: %v", err)
+			}
+			return
+		case "notify":
+			if len(os.Args) != 3 {
+				log.Fatalf("usage: %s notify <result.json>", os.Args[0])
+			}
+			rep, err := report.Load(os.Args[2])
+			if err != nil {
+				log.Fatalf("CRITICAL: %v", err)
+			}
+			if err := notify.Send(*rep); err != nil {
+				log.Fatalf("CRITICAL: %v", err)
+			}
+			return
+		case "cache":
+			if err := runCache(os.Args[2:]); err != nil {
+				log.Fatalf("CRITICAL: %v", err)
+			}
+			return
+		case "cache-bench":
+			if err := flow_logs.BenchmarkCacheFormats(); err != nil {
+				log.Fatalf("CRITICAL: %v", err)
+			}
+			return
+		case "tui":
+			path := filepath.Join(config.GetEnv("OUTPUT_DIR"), "result.json")
+			if len(os.Args) > 2 {
+				path = os.Args[2]
+			}
+			rep, err := report.Load(path)
+			if err != nil {
+				log.Fatalf("CRITICAL: %v", err)
+			}
+			if err := tui.Run(rep); err != nil {
+				log.Fatalf("CRITICAL: %v", err)
+			}
+			return
+		case "serve":
+			if err := runServe(); err != nil {
+				log.Fatalf("CRITICAL: %v", err)
+			}
+			return
+		default:
+			log.Fatalf("unknown command %q", os.Args[1])
+		}
+	}
+
+	rep, err := flow_logs.Analyze()
+	if err != nil {
+		log.Fatalf("CRITICAL: %v", err)
+	}
+	if notify.Enabled() {
+		if err := notify.Send(rep); err != nil {
+			log.Printf("WARNING: webhook notification failed: %v", err)
+		}
+	}
+	os.Exit(budget.ExitCode(rep.BudgetViolations))
+}
+
+func runDiff(oldPath, newPath string) error {
+	before, err := report.Load(oldPath)
+	if err != nil {
+		return err
+	}
+	after, err := report.Load(newPath)
+	if err != nil {
+		return err
+	}
+
+	d := report.Compare(before, after, config.GetEnvInt("DIFF_TOP_N"))
+
+	j, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal diff: %w", err)
+	}
+	dir := config.GetEnv("OUTPUT_DIR")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("mkdir output: %w", err)
+	}
+	fpath := filepath.Join(dir, "diff.json")
+	if err := os.WriteFile(fpath, j, 0644); err != nil {
+		return fmt.Errorf("write %s: %w", fpath, err)
+	}
+
+	report.PrintDiff(d)
+	fmt.Printf("💾 Saved %s\n", fpath)
+	return nil
+}
+
+func runCache(args []string) error {
+	usage := fmt.Errorf("usage: %s cache list | inspect <id> | prune [-older-than 30d] [-max-size 10GB] | clear", os.Args[0])
+	if len(args) == 0 {
+		return usage
+	}
+
+	switch args[0] {
+	case "list":
+		return flow_logs.PrintCacheList()
+	case "inspect":
+		if len(args) != 2 {
+			return usage
+		}
+		return flow_logs.InspectCachedDay(args[1])
+	case "prune":
+		fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+		olderThan := fs.String("older-than", "", "remove days not used for this long, e.g. 30d")
+		maxSize := fs.String("max-size", config.GetEnv("CACHE_MAX_SIZE"), "remove least recently used days above this size, e.g. 10GB")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		age, size := time.Duration(0), int64(0)
+		var err error
+		if *olderThan != "" {
+			if age, err = flow_logs.ParseAge(*olderThan); err != nil {
+				return err
+			}
+		}
+		if size, err = flow_logs.ParseSize(*maxSize); err != nil {
+			return err
+		}
+		if age == 0 && size == 0 {
+			return usage
+		}
+		return flow_logs.PruneCache(age, size)
+	case "clear":
+		return flow_logs.ClearCache()
+	default:
+		return usage
+	}
+}
+
+func runServe() error {
+	interval, err := time.ParseDuration(config.GetEnv("SERVE_REFRESH_INTERVAL"))
+	if err != nil {
+		return fmt.Errorf("invalid SERVE_REFRESH_INTERVAL: %w", err)
+	}
+
+	server := metrics.NewServer(config.GetEnvInt("METRICS_TOP_N"))
+	return server.Run(config.GetEnv("SERVE_ADDR"), interval, flow_logs.AnalyzeReport)
 }
@@ -0,0 +1,153 @@
+package budget
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"vpc_flowlogs_egress_analyzer/internal/config"
+	"vpc_flowlogs_egress_analyzer/internal/report"
+)
+
+const (
+	ExitWarning  = 3
+	ExitCritical = 4
+)
+
+// Thresholds maps a key (AWS service, IP) to a limit, "*" applies to every other key
+type Thresholds map[string]float64
+
+func (t Thresholds) For(key string) (float64, bool) {
+	if v, ok := t[key]; ok {
+		return v, true
+	}
+	v, ok := t["*"]
+	return v, ok
+}
+
+type Level struct {
+	Warning  Thresholds
+	Critical Thresholds
+}
+
+type Budgets struct {
+	DailyCostUSD   Level // single "*" threshold
+	ServiceCostUSD Level
+	DestinationGB  Level
+	SourceGB       Level
+}
+
+// FromEnv reads BUDGET_*_WARNING / BUDGET_*_CRITICAL variables. Values are either a
+// number applying to every key, or a list like "S3=5,DYNAMODB=2,*=10".
+func FromEnv() Budgets {
+	level := func(name string) Level {
+		return Level{
+			Warning:  parseThresholds("BUDGET_"+name+"_WARNING", config.GetEnv("BUDGET_"+name+"_WARNING")),
+			Critical: parseThresholds("BUDGET_"+name+"_CRITICAL", config.GetEnv("BUDGET_"+name+"_CRITICAL")),
+		}
+	}
+	return Budgets{
+		DailyCostUSD:   level("DAILY_COST_USD"),
+		ServiceCostUSD: level("SERVICE_COST_USD"),
+		DestinationGB:  level("DESTINATION_GB"),
+		SourceGB:       level("SOURCE_GB"),
+	}
+}
+
+func parseThresholds(name, value string) Thresholds {
+	t := Thresholds{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, raw := "*", part
+		if k, v, found := strings.Cut(part, "="); found {
+			key, raw = strings.TrimSpace(k), strings.TrimSpace(v)
+		}
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil || key == "" {
+			log.Printf("Invalid budget in %s: %q, ignored", name, part)
+			continue
+		}
+		t[key] = f
+	}
+	return t
+}
+
+// Evaluate returns every exceeded budget, critical before warning. A key over its
+// critical threshold is not reported again as a warning.
+func Evaluate(r report.Report, b Budgets) []report.BudgetViolation {
+	var violations []report.BudgetViolation
+
+	check := func(budget, key, unit string, value float64, level Level) {
+		if limit, ok := level.Critical.For(key); ok && value > limit {
+			violations = append(violations, report.BudgetViolation{Budget: budget, Key: key, Level: report.BudgetCritical, Value: value, Threshold: limit, Unit: unit})
+			return
+		}
+		if limit, ok := level.Warning.For(key); ok && value > limit {
+			violations = append(violations, report.BudgetViolation{Budget: budget, Key: key, Level: report.BudgetWarning, Value: value, Threshold: limit, Unit: unit})
+		}
+	}
+
+	check(report.BudgetDailyCost, "total", "USD", r.Total.CostUSD, b.DailyCostUSD)
+
+	byService := map[string]float64{}
+	for _, e := range r.EgressByAwsService {
+		byService[e.Service] += e.CostUSD
+	}
+	for svc, c := range byService {
+		check(report.BudgetServiceCost, svc, "USD", c, b.ServiceCostUSD)
+	}
+
+	for _, e := range r.EgressByIP {
+		check(report.BudgetDestinationGB, e.IP, "GB", e.GB, b.DestinationGB)
+	}
+	for _, e := range r.EgressBySource {
+		check(report.BudgetSourceGB, e.Source, "GB", e.GB, b.SourceGB)
+	}
+
+	sort.Slice(violations, func(i, j int) bool {
+		if violations[i].Level != violations[j].Level {
+			return violations[i].Level == report.BudgetCritical
+		}
+		if violations[i].Budget != violations[j].Budget {
+			return violations[i].Budget < violations[j].Budget
+		}
+		if violations[i].Value != violations[j].Value {
+			return violations[i].Value > violations[j].Value
+		}
+		return violations[i].Key < violations[j].Key
+	})
+	return violations
+}
+
+func ExitCode(violations []report.BudgetViolation) int {
+	code := 0
+	for _, v := range violations {
+		switch v.Level {
+		case report.BudgetCritical:
+			return ExitCritical
+		case report.BudgetWarning:
+			code = ExitWarning
+		}
+	}
+	return code
+}
+
+func Print(violations []report.BudgetViolation) {
+	if len(violations) == 0 {
+		return
+	}
+
+	fmt.Println("💸 Budget Violations:")
+	for _, v := range violations {
+		icon := "⚠️"
+		if v.Level == report.BudgetCritical {
+			icon = "🛑"
+		}
+		fmt.Printf("   %s %-8s %-15s %-39s %10.2f %s > %.2f %s\n", icon, v.Level, v.Budget, v.Key, v.Value, v.Unit, v.Threshold, v.Unit)
+	}
+	fmt.Println("=================================================================")
+}
@@ -0,0 +1,99 @@
+package budget
+
+import (
+	"reflect"
+	"testing"
+	"vpc_flowlogs_egress_analyzer/internal/report"
+)
+
+func TestParseThresholds(t *testing.T) {
+	cases := []struct {
+		value string
+		want  Thresholds
+	}{
+		{"", Thresholds{}},
+		{"10", Thresholds{"*": 10}},
+		{"S3=5,DYNAMODB=2.5,*=10", Thresholds{"S3": 5, "DYNAMODB": 2.5, "*": 10}},
+		{" S3 = 5 , , *=1 ", Thresholds{"S3": 5, "*": 1}},
+		{"S3=five,*=10", Thresholds{"*": 10}},
+		{"S3=,=3,*=1", Thresholds{"*": 1}},
+		{"abc", Thresholds{}},
+	}
+	for _, c := range cases {
+		if got := parseThresholds("BUDGET_TEST", c.value); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseThresholds(%q) = %v, expected %v", c.value, got, c.want)
+		}
+	}
+}
+
+func TestThresholdsFor(t *testing.T) {
+	th := Thresholds{"S3": 5, "*": 10}
+	if v, ok := th.For("S3"); !ok || v != 5 {
+		t.Errorf("S3: got %v, %t", v, ok)
+	}
+	if v, ok := th.For("ECR"); !ok || v != 10 {
+		t.Errorf("ECR falls back to *: got %v, %t", v, ok)
+	}
+	if _, ok := (Thresholds{"S3": 5}).For("ECR"); ok {
+		t.Errorf("a key without threshold nor * has no budget")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	r := report.Report{
+		Total: report.Total{CostUSD: 12},
+		EgressByAwsService: []report.ServiceEntry{
+			{Service: "S3", Region: "eu-west-3", CostUSD: 3},
+			{Service: "S3", Region: "us-east-1", CostUSD: 4},
+			{Service: "ECR", Region: "eu-west-3", CostUSD: 1},
+		},
+		EgressByIP: []report.IPEntry{
+			{IP: "8.8.8.8", GB: 60},
+			{IP: "1.1.1.1", GB: 30},
+			{IP: "9.9.9.9", GB: 5},
+		},
+	}
+	b := Budgets{
+		DailyCostUSD:   Level{Warning: Thresholds{"*": 10}, Critical: Thresholds{"*": 20}},
+		ServiceCostUSD: Level{Warning: Thresholds{"S3": 5}},
+		DestinationGB:  Level{Warning: Thresholds{"*": 20}, Critical: Thresholds{"*": 50}},
+	}
+
+	var got []string
+	for _, v := range Evaluate(r, b) {
+		got = append(got, v.Level+"/"+v.Budget+"/"+v.Key)
+	}
+	want := []string{
+		// A key over its critical threshold is not reported again as a warning
+		report.BudgetCritical + "/" + report.BudgetDestinationGB + "/8.8.8.8",
+		report.BudgetWarning + "/" + report.BudgetDailyCost + "/total",
+		report.BudgetWarning + "/" + report.BudgetDestinationGB + "/1.1.1.1",
+		// Service costs add up over regions
+		report.BudgetWarning + "/" + report.BudgetServiceCost + "/S3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, expected %v", got, want)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	warning := report.BudgetViolation{Level: report.BudgetWarning}
+	critical := report.BudgetViolation{Level: report.BudgetCritical}
+
+	cases := []struct {
+		name       string
+		violations []report.BudgetViolation
+		want       int
+	}{
+		{"none", nil, 0},
+		{"warning", []report.BudgetViolation{warning, warning}, ExitWarning},
+		{"critical", []report.BudgetViolation{critical}, ExitCritical},
+		{"critical over an earlier warning", []report.BudgetViolation{warning, critical}, ExitCritical},
+		{"critical over a later warning", []report.BudgetViolation{critical, warning}, ExitCritical},
+	}
+	for _, c := range cases {
+		if got := ExitCode(c.violations); got != c.want {
+			t.Errorf("%s: exit code %d, expected %d", c.name, got, c.want)
+		}
+	}
+}
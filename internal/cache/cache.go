@@ -1,70 +1,74 @@
 package cache
 
 import (
-	"compress/gzip"
-	"encoding/json"
-	"fmt"
+	"context"
+	"errors"
+	"io"
 	"os"
-	"path"
+	"path/filepath"
+	"sync"
+	"time"
+	"vpc_flowlogs_egress_analyzer/internal/config"
 )
 
-const cacheDir = ".cache"
+const appName = "vpc-flowlogs-egress-analyzer"
 
-func cachePath(key string) string {
-	return path.Join(cacheDir, key+".json.gz")
-}
+var (
+	cacheDir     string
+	initCacheDir sync.Once
+)
 
-func Exists(key string) bool {
-	_, err := os.Stat(cachePath(key))
-	return err == nil
+// Dir is CACHE_DIR, or the application directory in the user cache dir ($XDG_CACHE_HOME,
+// ~/.cache, ~/Library/Caches), or .cache when there is no home directory
+func Dir() string {
+	initCacheDir.Do(func() {
+		cacheDir = config.GetEnv("CACHE_DIR")
+		if cacheDir != "" {
+			return
+		}
+		if userDir, err := os.UserCacheDir(); err == nil {
+			cacheDir = filepath.Join(userDir, appName)
+		} else {
+			cacheDir = ".cache"
+		}
+	})
+	return cacheDir
 }
 
-func Load[T any](key string) (T, error) {
-	var result T
-
-	fpath := cachePath(key)
-	f, err := os.Open(fpath)
-	if err != nil {
-		return result, fmt.Errorf("unable to open cache file: %w", err)
-	}
-	defer f.Close()
+var (
+	// ErrNotFound is returned by backends for keys they do not hold
+	ErrNotFound = errors.New("cache entry not found")
 
-	gz, err := gzip.NewReader(f)
-	if err != nil {
-		return result, fmt.Errorf("gzip reader: %w", err)
-	}
-	defer gz.Close()
-
-	decoder := json.NewDecoder(gz)
-	err = decoder.Decode(&result)
-	if err != nil {
-		return result, fmt.Errorf("json decode: %w", err)
-	}
+	// ErrCorrupt is returned when a cache file cannot be decoded or does not match its checksum
+	ErrCorrupt = errors.New("corrupt cache entry")
+)
 
-	return result, nil
+// Cache stores opaque entries under slash-separated keys, encoding is left to a Codec.
+// Put must never let a reader see a partially written entry.
+type Cache interface {
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Put(ctx context.Context, key string, r io.Reader) error
+	Exists(ctx context.Context, key string) (bool, error)
+	List(ctx context.Context, prefix string) ([]Entry, error)
+	Delete(ctx context.Context, key string) error
 }
 
-func Save(key string, data any) error {
-	err := os.MkdirAll(cacheDir, 0755)
-	if err != nil {
-		return fmt.Errorf("mkdir cache: %w", err)
-	}
+// Toucher is implemented by backends that track when entries were last used
+type Toucher interface {
+	Touch(ctx context.Context, key string) error
+}
 
-	fpath := cachePath(key)
-	f, err := os.Create(fpath)
-	if err != nil {
-		return fmt.Errorf("create cache file: %w", err)
-	}
-	defer f.Close()
+// Entry describes a stored entry, ModTime is its last use for backends implementing Toucher
+type Entry struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
 
-	gz, e := gzip.NewWriterLevel(f, gzip.BestSpeed)
-	if e != nil {
-		return e
+// touch marks an entry as used when the backend supports it
+func touch(ctx context.Context, c Cache, key string) error {
+	if t, ok := c.(Toucher); ok {
+		return t.Touch(ctx, key)
 	}
-	defer gz.Close()
-
-	encoder := json.NewEncoder(gz)
-	encoder.SetIndent("", "  ")
-
-	return encoder.Encode(data)
+	return nil
 }
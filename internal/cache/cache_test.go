@@ -0,0 +1,276 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingReader returns some data, then an error, like a download cut short
+type failingReader struct {
+	sent bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if !r.sent {
+		r.sent = true
+		return copy(p, "partial"), nil
+	}
+	return 0, errors.New("connection reset")
+}
+
+func listKeys(t *testing.T, c Cache, prefix string) []string {
+	t.Helper()
+	entries, err := c.List(context.Background(), prefix)
+	if err != nil {
+		t.Fatalf("list %q: %v", prefix, err)
+	}
+	keys := []string{}
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	return keys
+}
+
+// testContract checks the behavior every Cache backend shares
+func testContract(t *testing.T, c Cache) {
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, "ns/missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get missing: expected ErrNotFound, got %v", err)
+	}
+	if ok, err := c.Exists(ctx, "ns/missing"); ok || err != nil {
+		t.Fatalf("exists missing: got %v, %v", ok, err)
+	}
+	if keys := listKeys(t, c, ""); len(keys) != 0 {
+		t.Fatalf("empty cache lists %v", keys)
+	}
+	if err := c.Delete(ctx, "ns/missing"); err != nil && !errors.Is(err, ErrNotFound) {
+		t.Fatalf("delete missing: %v", err)
+	}
+
+	for _, key := range []string{"ns/b", "ns/a", "ns/sub/c", "other/d"} {
+		if err := c.Put(ctx, key, strings.NewReader("value of "+key)); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+	if got := readAll(t, c, "ns/sub/c"); got != "value of ns/sub/c" {
+		t.Fatalf("get ns/sub/c: got %q", got)
+	}
+	if ok, err := c.Exists(ctx, "ns/a"); !ok || err != nil {
+		t.Fatalf("exists ns/a: got %v, %v", ok, err)
+	}
+
+	// Overwriting replaces the whole entry
+	if err := c.Put(ctx, "ns/a", strings.NewReader("new")); err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+	if got := readAll(t, c, "ns/a"); got != "new" {
+		t.Fatalf("get overwritten ns/a: got %q", got)
+	}
+
+	entries, err := c.List(ctx, "ns/")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var got []Entry
+	for _, e := range entries {
+		got = append(got, Entry{Key: e.Key, Size: e.Size})
+	}
+	want := []Entry{{Key: "ns/a", Size: 3}, {Key: "ns/b", Size: 13}, {Key: "ns/sub/c", Size: 17}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("list ns/: got %+v, expected %+v in key order", got, want)
+	}
+
+	// A failed write leaves nothing behind, not even a partial entry
+	if err := c.Put(ctx, "ns/failed", &failingReader{}); err == nil {
+		t.Fatalf("put from a failing reader succeeded")
+	}
+	if ok, _ := c.Exists(ctx, "ns/failed"); ok {
+		t.Fatalf("a failed put left an entry")
+	}
+	if keys := listKeys(t, c, "ns/"); len(keys) != 3 {
+		t.Fatalf("a failed put changed the listing: %v", keys)
+	}
+
+	if err := c.Delete(ctx, "ns/b"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := c.Get(ctx, "ns/b"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get deleted: expected ErrNotFound, got %v", err)
+	}
+	if keys := listKeys(t, c, ""); !reflect.DeepEqual(keys, []string{"ns/a", "ns/sub/c", "other/d"}) {
+		t.Fatalf("list after delete: %v", keys)
+	}
+
+	// Codecs on top of the backend: a damaged entry is reported as corrupt
+	info, err := Write(ctx, c, "ns/value", JSON, []int{1, 2, 3})
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if v, err := LoadVerified[[]int](ctx, c, "ns/value", JSON, info); err != nil || !reflect.DeepEqual(v, []int{1, 2, 3}) {
+		t.Fatalf("load verified: got %v, %v", v, err)
+	}
+	if err := c.Put(ctx, "ns/value"+JSON.Ext(), strings.NewReader("garbage")); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if _, err := LoadVerified[[]int](ctx, c, "ns/value", JSON, info); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("load damaged: expected ErrCorrupt, got %v", err)
+	}
+	if _, err := Load[[]int](ctx, c, "ns/value", JSON); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("load undecodable: expected ErrCorrupt, got %v", err)
+	}
+	if err := Remove(ctx, c, "ns/value", JSON); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := Remove(ctx, c, "ns/value", JSON); err != nil {
+		t.Fatalf("remove missing: %v", err)
+	}
+
+	if _, ok := c.(Toucher); !ok {
+		return
+	}
+	before := entryTime(t, c, "ns/a")
+	time.Sleep(20 * time.Millisecond)
+	if err := touch(ctx, c, "ns/a"); err != nil {
+		t.Fatalf("touch: %v", err)
+	}
+	if after := entryTime(t, c, "ns/a"); !after.After(before) {
+		t.Fatalf("touch did not move the last use from %v, got %v", before, after)
+	}
+}
+
+func entryTime(t *testing.T, c Cache, key string) time.Time {
+	t.Helper()
+	entries, err := c.List(context.Background(), key)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("list %s: %v, %v", key, entries, err)
+	}
+	return entries[0].ModTime
+}
+
+func TestContract(t *testing.T) {
+	backends := map[string]func(t *testing.T) Cache{
+		"memory": func(t *testing.T) Cache { return NewMemory() },
+		"fs":     func(t *testing.T) Cache { return NewFS(t.TempDir()) },
+		"fs without directory": func(t *testing.T) Cache {
+			return NewFS(filepath.Join(t.TempDir(), "not", "created"))
+		},
+		"limited memory": func(t *testing.T) Cache { return NewLimited(NewMemory(), 1<<20, dayGroup) },
+		"limited fs":     func(t *testing.T) Cache { return NewLimited(NewFS(t.TempDir()), 1<<20, dayGroup) },
+		"tiered fs":      func(t *testing.T) Cache { return NewTiered(NewFS(t.TempDir()), NewMemory()) },
+		"s3": func(t *testing.T) Cache {
+			c, _ := newTestS3(t)
+			return c
+		},
+	}
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			testContract(t, backend(t))
+		})
+	}
+}
+
+func TestFSLeavesNoTemporaryFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	c := NewFS(dir)
+
+	if err := c.Put(ctx, "ns/a", strings.NewReader("value")); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if err := c.Put(ctx, "ns/b", &failingReader{}); err == nil {
+		t.Fatalf("put from a failing reader succeeded")
+	}
+
+	files, err := os.ReadDir(filepath.Join(dir, "ns"))
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	if len(files) != 1 || files[0].Name() != "a" {
+		t.Fatalf("directory holds %v, expected only a", files)
+	}
+
+	// A temporary file left by a crashed writer is not an entry
+	if err := os.WriteFile(filepath.Join(dir, "ns", "c"+tempMarker+"123"), []byte("partial"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if keys := listKeys(t, c, ""); !reflect.DeepEqual(keys, []string{"ns/a"}) {
+		t.Fatalf("list: %v", keys)
+	}
+
+	if err := c.Clear(); err != nil {
+		t.Fatalf("clear: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("clear left the directory: %v", err)
+	}
+}
+
+func TestTieredFSReadThrough(t *testing.T) {
+	ctx := context.Background()
+	local, remote := NewFS(t.TempDir()), NewMemory()
+	tiered := NewTiered(NewLimited(local, 1<<20, dayGroup), remote)
+
+	if err := remote.Put(ctx, "day1/chunk", bytes.NewReader([]byte("shared"))); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if keys := listKeys(t, tiered, ""); len(keys) != 0 {
+		t.Fatalf("list covers the remote tier: %v", keys)
+	}
+	if got := readAll(t, tiered, "day1/chunk"); got != "shared" {
+		t.Fatalf("get: got %q", got)
+	}
+	if got := readAll(t, local, "day1/chunk"); got != "shared" {
+		t.Fatalf("read-through did not copy to the local directory: %q", got)
+	}
+
+	// A remote entry replaced meanwhile is not read again once copied
+	if err := remote.Put(ctx, "day1/chunk", bytes.NewReader([]byte("changed"))); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if got := readAll(t, tiered, "day1/chunk"); got != "shared" {
+		t.Fatalf("get: got %q, expected the local copy", got)
+	}
+
+	if err := tiered.Put(ctx, "day2/chunk", bytes.NewReader([]byte("mine"))); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if err := tiered.Publish(ctx, "day2/chunk"); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if got := readAll(t, remote, "day2/chunk"); got != "mine" {
+		t.Fatalf("published: got %q", got)
+	}
+	if err := tiered.Publish(ctx, "day3/missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("publish missing: expected ErrNotFound, got %v", err)
+	}
+	if ok, _ := remote.Exists(ctx, "day3/missing"); ok {
+		t.Fatalf("publishing a missing entry created it remotely")
+	}
+}
+
+func TestTieredPublishFileToS3(t *testing.T) {
+	ctx := context.Background()
+	remote, fake := newTestS3(t)
+	tiered := NewTiered(NewFS(t.TempDir()), remote)
+
+	if _, err := Write(ctx, tiered, "day1/manifest", JSON, map[string]int{"chunks": 3}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := tiered.Publish(ctx, "day1/manifest"+JSON.Ext()); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if _, ok := fake.objects["team/day1/manifest"+JSON.Ext()]; !ok {
+		t.Fatalf("manifest not uploaded: %v", fake.objects)
+	}
+	if v, err := Load[map[string]int](ctx, remote, "day1/manifest", JSON); err != nil || v["chunks"] != 3 {
+		t.Fatalf("load published: got %v, %v", v, err)
+	}
+}
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Info identifies the exact content of a cache file
+type Info struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Codec turns values into cache file content, Ext is appended to the key to name the file
+type Codec interface {
+	Ext() string
+	Encode(w io.Writer, v any) error
+	Decode(r io.Reader, v any) error
+}
+
+// JSON is gzip compressed indented JSON, readable with zcat for debugging
+var JSON Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Ext() string {
+	return ".json.gz"
+}
+
+func (jsonCodec) Encode(w io.Writer, v any) error {
+	gz, err := gzip.NewWriterLevel(w, gzip.BestSpeed)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(gz)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("json encode: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("gzip close: %w", err)
+	}
+	return nil
+}
+
+func (jsonCodec) Decode(r io.Reader, v any) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("gzip reader: %w", err)
+	}
+	defer gz.Close()
+
+	if err := json.NewDecoder(gz).Decode(v); err != nil {
+		return fmt.Errorf("json decode: %w", err)
+	}
+	return nil
+}
+
+// Exists reports whether key is stored with codec
+func Exists(ctx context.Context, c Cache, key string, codec Codec) (bool, error) {
+	return c.Exists(ctx, key+codec.Ext())
+}
+
+func Load[T any](ctx context.Context, c Cache, key string, codec Codec) (T, error) {
+	var result T
+
+	r, err := c.Get(ctx, key+codec.Ext())
+	if err != nil {
+		return result, fmt.Errorf("unable to open cache file: %w", err)
+	}
+	defer r.Close()
+
+	return decode[T](r, codec)
+}
+
+// LoadVerified loads a cache file and checks it against the Info recorded when it was
+// written, before decoding so a damaged file never reaches the codec. A missing file is
+// corrupt as well.
+func LoadVerified[T any](ctx context.Context, c Cache, key string, codec Codec, want Info) (T, error) {
+	var result T
+
+	r, err := c.Get(ctx, key+codec.Ext())
+	if err != nil {
+		return result, fmt.Errorf("%w: unable to open cache file: %w", ErrCorrupt, err)
+	}
+	defer r.Close()
+
+	// One byte more than expected is enough to tell the file is too large
+	data, err := io.ReadAll(io.LimitReader(r, want.Size+1))
+	if err != nil {
+		return result, fmt.Errorf("read cache file: %w", err)
+	}
+
+	h := sha256.Sum256(data)
+	if got := hex.EncodeToString(h[:]); int64(len(data)) != want.Size || got != want.SHA256 {
+		return result, fmt.Errorf("%w: %s is %d bytes with sha256 %s, expected %d bytes with sha256 %s",
+			ErrCorrupt, key, len(data), got, want.Size, want.SHA256)
+	}
+	return decode[T](bytes.NewReader(data), codec)
+}
+
+func decode[T any](r io.Reader, codec Codec) (T, error) {
+	var result T
+	if err := codec.Decode(r, &result); err != nil {
+		return result, fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	return result, nil
+}
+
+func Save(ctx context.Context, c Cache, key string, data any) error {
+	_, err := Write(ctx, c, key, JSON, data)
+	return err
+}
+
+// Write encodes data and stores it, returning the Info to verify it with later
+func Write(ctx context.Context, c Cache, key string, codec Codec, data any) (Info, error) {
+	var buf bytes.Buffer
+	if err := codec.Encode(&buf, data); err != nil {
+		return Info{}, err
+	}
+	h := sha256.Sum256(buf.Bytes())
+	info := Info{Size: int64(buf.Len()), SHA256: hex.EncodeToString(h[:])}
+
+	if err := c.Put(ctx, key+codec.Ext(), &buf); err != nil {
+		return Info{}, err
+	}
+	return info, nil
+}
+
+// Remove deletes key, removing a missing entry is not an error
+func Remove(ctx context.Context, c Cache, key string, codec Codec) error {
+	err := c.Delete(ctx, key+codec.Ext())
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Touch marks an entry as used, for backends evicting the least recently used entries
+func Touch(ctx context.Context, c Cache, key string, codec Codec) error {
+	return touch(ctx, c, key+codec.Ext())
+}
@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const tempMarker = ".tmp-"
+
+// FS stores entries as files under a directory
+type FS struct {
+	dir string
+}
+
+func NewFS(dir string) *FS {
+	return &FS{dir: dir}
+}
+
+func (f *FS) Dir() string {
+	return f.dir
+}
+
+func (f *FS) path(key string) string {
+	return filepath.Join(f.dir, filepath.FromSlash(key))
+}
+
+func (f *FS) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	file, err := os.Open(f.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return file, err
+}
+
+// Put writes through a temporary file that is synced and renamed into place, so readers
+// never see a partial file
+func (f *FS) Put(_ context.Context, key string, r io.Reader) error {
+	fpath := f.path(key)
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return fmt.Errorf("mkdir cache: %w", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(fpath), filepath.Base(fpath)+tempMarker+"*")
+	if err != nil {
+		return fmt.Errorf("create cache file: %w", err)
+	}
+	tmp := file.Name()
+	defer os.Remove(tmp)
+	defer file.Close()
+
+	if err := file.Chmod(0644); err != nil {
+		return fmt.Errorf("chmod cache file: %w", err)
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		return fmt.Errorf("write cache file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("sync cache file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("close cache file: %w", err)
+	}
+	if err := os.Rename(tmp, fpath); err != nil {
+		return fmt.Errorf("rename cache file: %w", err)
+	}
+	syncDir(filepath.Dir(fpath))
+	return nil
+}
+
+func (f *FS) Exists(_ context.Context, key string) (bool, error) {
+	_, err := os.Stat(f.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// List returns the entries whose key starts with prefix, in lexical order
+func (f *FS) List(_ context.Context, prefix string) ([]Entry, error) {
+	var entries []Entry
+	err := filepath.WalkDir(f.dir, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == f.dir {
+			return filepath.SkipAll
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.Contains(d.Name(), tempMarker) {
+			return nil
+		}
+		rel, err := filepath.Rel(f.dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, Entry{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list cache: %w", err)
+	}
+	return entries, nil
+}
+
+func (f *FS) Delete(_ context.Context, key string) error {
+	err := os.Remove(f.path(key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove cache file: %w", err)
+	}
+	return nil
+}
+
+// Touch sets the modification time, which List reports as the last use
+func (f *FS) Touch(_ context.Context, key string) error {
+	now := time.Now()
+	return os.Chtimes(f.path(key), now, now)
+}
+
+// Clear removes the whole directory
+func (f *FS) Clear() error {
+	if err := os.RemoveAll(f.dir); err != nil {
+		return fmt.Errorf("clear cache: %w", err)
+	}
+	return nil
+}
+
+// syncDir persists the rename, it is best effort as not every platform supports it
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
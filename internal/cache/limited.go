@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limited evicts the least recently used entries once the cache holds more than MaxSize
+// bytes. Group maps a key to the set of entries evicted together (e.g. the chunks and
+// manifest of a day), the group being written is never evicted. The cache is listed once,
+// then entries written, touched and deleted through Limited are tracked in memory.
+type Limited struct {
+	Cache
+	MaxSize int64
+	Group   func(key string) string
+	OnEvict func(group string, size int64, lastUsed time.Time)
+
+	mu      sync.Mutex
+	entries map[string]Entry // nil until listed
+	size    int64
+}
+
+func NewLimited(c Cache, maxSize int64, group func(key string) string) *Limited {
+	return &Limited{Cache: c, MaxSize: maxSize, Group: group}
+}
+
+func (l *Limited) Put(ctx context.Context, key string, r io.Reader) error {
+	cr := &countingReader{r: r}
+	if err := l.Cache.Put(ctx, key, cr); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err := l.list(ctx)
+	if err == nil {
+		l.set(Entry{Key: key, Size: cr.n, ModTime: time.Now()})
+		if l.size > l.MaxSize {
+			err = l.evict(ctx, l.Group(key))
+		}
+	}
+	if err != nil {
+		fmt.Printf("⚠️ Cache eviction failed: %v\n", err)
+	}
+	return nil
+}
+
+func (l *Limited) Delete(ctx context.Context, key string) error {
+	if err := l.Cache.Delete(ctx, key); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.remove(key)
+	return nil
+}
+
+func (l *Limited) Touch(ctx context.Context, key string) error {
+	if err := touch(ctx, l.Cache, key); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.entries[key]; ok {
+		e.ModTime = time.Now()
+		l.entries[key] = e
+	}
+	return nil
+}
+
+type entryGroup struct {
+	name     string
+	entries  []Entry
+	size     int64
+	lastUsed time.Time
+}
+
+// Evict lists the cache again, then removes whole groups, least recently used first, until
+// it fits in MaxSize
+func (l *Limited) Evict(ctx context.Context, keep string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = nil
+	if err := l.list(ctx); err != nil {
+		return err
+	}
+	return l.evict(ctx, keep)
+}
+
+// list loads the entries of the cache the first time they are needed
+func (l *Limited) list(ctx context.Context) error {
+	if l.entries != nil {
+		return nil
+	}
+
+	entries, err := l.Cache.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	l.entries = make(map[string]Entry, len(entries))
+	l.size = 0
+	for _, e := range entries {
+		l.set(e)
+	}
+	return nil
+}
+
+func (l *Limited) set(e Entry) {
+	l.remove(e.Key)
+	l.entries[e.Key] = e
+	l.size += e.Size
+}
+
+func (l *Limited) remove(key string) {
+	if e, ok := l.entries[key]; ok {
+		delete(l.entries, key)
+		l.size -= e.Size
+	}
+}
+
+func (l *Limited) evict(ctx context.Context, keep string) error {
+	if l.size <= l.MaxSize {
+		return nil
+	}
+
+	byName := make(map[string]*entryGroup)
+	var groups []*entryGroup
+	for _, e := range l.entries {
+		name := l.Group(e.Key)
+		g, ok := byName[name]
+		if !ok {
+			g = &entryGroup{name: name}
+			byName[name] = g
+			groups = append(groups, g)
+		}
+		g.entries = append(g.entries, e)
+		g.size += e.Size
+		if e.ModTime.After(g.lastUsed) {
+			g.lastUsed = e.ModTime
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].lastUsed.Before(groups[j].lastUsed) })
+	for _, g := range groups {
+		if l.size <= l.MaxSize {
+			break
+		}
+		if g.name == keep {
+			continue
+		}
+		// Most recently used first: the entry that is touched on every use, like a
+		// manifest, references the others and must not outlive them
+		sort.Slice(g.entries, func(i, j int) bool { return g.entries[i].ModTime.After(g.entries[j].ModTime) })
+		for _, e := range g.entries {
+			if err := l.Cache.Delete(ctx, e.Key); err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+			l.remove(e.Key)
+		}
+		if l.OnEvict != nil {
+			l.OnEvict(g.name, g.size, g.lastUsed)
+		}
+	}
+	return nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listCounter counts the full listings of the cache it wraps
+type listCounter struct {
+	Cache
+	lists int
+}
+
+func (c *listCounter) List(ctx context.Context, prefix string) ([]Entry, error) {
+	c.lists++
+	return c.Cache.List(ctx, prefix)
+}
+
+func dayGroup(key string) string {
+	day, _, _ := strings.Cut(key, "/")
+	return day
+}
+
+func TestLimitedEvictsLeastRecentlyUsedDays(t *testing.T) {
+	ctx := context.Background()
+	backend := &listCounter{Cache: NewMemory()}
+	limited := NewLimited(backend, 3*10*100, dayGroup)
+
+	var evicted []string
+	limited.OnEvict = func(group string, size int64, lastUsed time.Time) {
+		evicted = append(evicted, group)
+	}
+
+	chunk := bytes.Repeat([]byte("x"), 100)
+	for day := 1; day <= 5; day++ {
+		for i := 0; i < 10; i++ {
+			key := fmt.Sprintf("day%d/chunk-%02d", day, i)
+			if err := limited.Put(ctx, key, bytes.NewReader(chunk)); err != nil {
+				t.Fatalf("put %s: %v", key, err)
+			}
+		}
+	}
+
+	if backend.lists != 1 {
+		t.Fatalf("cache listed %d times for 50 writes, expected once", backend.lists)
+	}
+	if strings.Join(evicted, ",") != "day1,day2" {
+		t.Fatalf("evicted %v, expected day1 and day2", evicted)
+	}
+
+	entries, _ := backend.Cache.List(ctx, "")
+	if len(entries) != 30 || limited.size != 3000 {
+		t.Fatalf("cache holds %d entries, tracked size %d, expected 30 entries of 3000 bytes", len(entries), limited.size)
+	}
+
+	// Rewriting an entry replaces its size instead of adding to it
+	if err := limited.Put(ctx, "day5/chunk-00", bytes.NewReader(chunk[:10])); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if err := limited.Delete(ctx, "day5/chunk-01"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if limited.size != 3000-90-100 {
+		t.Fatalf("tracked size %d after rewrite and delete, expected %d", limited.size, 3000-90-100)
+	}
+}
@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3 stores entries in a bucket of any S3-compatible store, under prefix
+type S3 struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func NewS3(client *s3.Client, bucket, prefix string) *S3 {
+	return &S3{client: client, bucket: bucket, prefix: strings.Trim(prefix, "/")}
+}
+
+func (c *S3) String() string {
+	return "s3://" + path.Join(c.bucket, c.prefix)
+}
+
+func (c *S3) objectKey(key string) string {
+	return path.Join(c.prefix, key)
+}
+
+func (c *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := c.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(c.objectKey(key)),
+	})
+	if isNotFound(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get %s from %s: %w", key, c, err)
+	}
+	return out.Body, nil
+}
+
+// Put uploads r in one request, S3 never exposes a partially uploaded object. The client
+// signs and sizes the body by seeking it, other readers are read into memory first.
+func (c *S3) Put(ctx context.Context, key string, r io.Reader) error {
+	body, ok := r.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("read cache entry: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	_, err := c.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(c.objectKey(key)),
+		Body:   body,
+	})
+	if err != nil {
+		return fmt.Errorf("put %s to %s: %w", key, c, err)
+	}
+	return nil
+}
+
+func (c *S3) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := c.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(c.objectKey(key)),
+	})
+	if isNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("head %s in %s: %w", key, c, err)
+	}
+	return true, nil
+}
+
+func (c *S3) List(ctx context.Context, prefix string) ([]Entry, error) {
+	root := ""
+	if c.prefix != "" {
+		root = c.prefix + "/"
+	}
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(c.bucket), Prefix: aws.String(root + prefix)}
+	paginator := s3.NewListObjectsV2Paginator(c.client, input)
+
+	var entries []Entry
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", c, err)
+		}
+		for _, obj := range page.Contents {
+			e := Entry{Key: strings.TrimPrefix(aws.ToString(obj.Key), root), Size: aws.ToInt64(obj.Size)}
+			if obj.LastModified != nil {
+				e.ModTime = *obj.LastModified
+			}
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func (c *S3) Delete(ctx context.Context, key string) error {
+	_, err := c.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(c.objectKey(key)),
+	})
+	if err != nil {
+		return fmt.Errorf("delete %s from %s: %w", key, c, err)
+	}
+	return nil
+}
+
+// isNotFound matches both NoSuchKey errors and bare 404 responses, HEAD requests have no
+// error body and some S3-compatible stores omit it on GET
+func isNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	var resp *awshttp.ResponseError
+	return errors.As(err, &noSuchKey) || errors.As(err, &notFound) ||
+		errors.As(err, &resp) && resp.HTTPStatusCode() == http.StatusNotFound
+}
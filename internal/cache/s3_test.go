@@ -0,0 +1,222 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// fakeS3 is a path-style S3 stand-in with the requests the S3 cache makes: GET, PUT, HEAD,
+// DELETE and ListObjectsV2 of a single bucket
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string][]byte
+	gets    int
+}
+
+type listResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string
+	Prefix      string
+	KeyCount    int
+	IsTruncated bool
+	Contents    []listObject
+}
+
+type listObject struct {
+	Key          string
+	Size         int
+	LastModified string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		prefix := r.URL.Query().Get("prefix")
+		result := listResult{Name: f.bucket, Prefix: prefix}
+		for k, data := range f.objects {
+			if strings.HasPrefix(k, prefix) {
+				result.Contents = append(result.Contents, listObject{Key: k, Size: len(data), LastModified: time.Now().UTC().Format(time.RFC3339)})
+			}
+		}
+		sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+		result.KeyCount = len(result.Contents)
+		w.Header().Set("Content-Type", "application/xml")
+		xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = data
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				io.WriteString(w, "<Error><Code>NoSuchKey</Code><Message>missing</Message></Error>")
+			}
+			return
+		}
+		if r.Method == http.MethodGet {
+			f.gets++
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	default:
+		http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestS3(t *testing.T) (*S3, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{bucket: "shared", objects: make(map[string][]byte)}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(srv.URL),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+	})
+	return NewS3(client, "shared", "team/"), fake
+}
+
+func readAll(t *testing.T, c Cache, key string) string {
+	t.Helper()
+	r, err := c.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("get %s: %v", key, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read %s: %v", key, err)
+	}
+	return string(data)
+}
+
+func TestS3(t *testing.T) {
+	ctx := context.Background()
+	c, fake := newTestS3(t)
+
+	if _, err := c.Get(ctx, "ns/missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get missing: expected ErrNotFound, got %v", err)
+	}
+	if ok, err := c.Exists(ctx, "ns/missing"); ok || err != nil {
+		t.Fatalf("exists missing: got %v, %v", ok, err)
+	}
+
+	for key, value := range map[string]string{"ns/a": "first", "ns/b": "second", "other/c": "third"} {
+		if err := c.Put(ctx, key, bytes.NewReader([]byte(value))); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+	if _, ok := fake.objects["team/ns/a"]; !ok {
+		t.Fatalf("put did not store under the prefix: %v", fake.objects)
+	}
+
+	if got := readAll(t, c, "ns/a"); got != "first" {
+		t.Fatalf("get ns/a: got %q", got)
+	}
+	if ok, err := c.Exists(ctx, "ns/b"); !ok || err != nil {
+		t.Fatalf("exists ns/b: got %v, %v", ok, err)
+	}
+
+	entries, err := c.List(ctx, "ns/")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Key != "ns/a" || entries[0].Size != 5 || entries[1].Key != "ns/b" {
+		t.Fatalf("list ns/: got %+v", entries)
+	}
+
+	if err := c.Delete(ctx, "ns/a"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if ok, _ := c.Exists(ctx, "ns/a"); ok {
+		t.Fatalf("ns/a still exists after delete")
+	}
+}
+
+func TestTieredReadThrough(t *testing.T) {
+	ctx := context.Background()
+	remote, fake := newTestS3(t)
+	local := NewMemory()
+	tiered := NewTiered(local, remote)
+
+	if err := remote.Put(ctx, "ns/day", bytes.NewReader([]byte("shared day"))); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	if ok, err := tiered.Exists(ctx, "ns/day"); !ok || err != nil {
+		t.Fatalf("exists: got %v, %v", ok, err)
+	}
+	for i := 0; i < 2; i++ {
+		if got := readAll(t, tiered, "ns/day"); got != "shared day" {
+			t.Fatalf("get: got %q", got)
+		}
+	}
+	if fake.gets != 1 {
+		t.Fatalf("remote read %d times, expected one copy into the local tier", fake.gets)
+	}
+	if got := readAll(t, local, "ns/day"); got != "shared day" {
+		t.Fatalf("local copy: got %q", got)
+	}
+
+	// Writes and deletes stay local until published
+	if err := tiered.Put(ctx, "ns/new", bytes.NewReader([]byte("mine"))); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if ok, _ := remote.Exists(ctx, "ns/new"); ok {
+		t.Fatalf("put reached the remote tier before publish")
+	}
+	if err := tiered.Publish(ctx, "ns/new"); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if got := readAll(t, remote, "ns/new"); got != "mine" {
+		t.Fatalf("published: got %q", got)
+	}
+
+	if err := tiered.Delete(ctx, "ns/day"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if ok, _ := remote.Exists(ctx, "ns/day"); !ok {
+		t.Fatalf("delete removed the remote copy")
+	}
+	if ok, _ := local.Exists(ctx, "ns/day"); ok {
+		t.Fatalf("delete left the local copy")
+	}
+}
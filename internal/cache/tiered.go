@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Tiered reads through Local to Remote: misses are copied from Remote into Local. Writes,
+// deletes, List and Touch only cover Local, entries reach Remote through Publish once they
+// are final, so work in progress or a local problem never alters what others read. A failing
+// Remote only costs a download, so its read errors are reported as warnings.
+type Tiered struct {
+	Local  Cache
+	Remote Cache
+}
+
+func NewTiered(local, remote Cache) *Tiered {
+	return &Tiered{Local: local, Remote: remote}
+}
+
+func (t *Tiered) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	r, err := t.Local.Get(ctx, key)
+	if !errors.Is(err, ErrNotFound) {
+		return r, err
+	}
+
+	remote, remoteErr := t.Remote.Get(ctx, key)
+	if remoteErr != nil {
+		if !errors.Is(remoteErr, ErrNotFound) {
+			fmt.Printf("⚠️ Warning: shared cache: %v\n", remoteErr)
+		}
+		return nil, err
+	}
+	defer remote.Close()
+
+	if err := t.Local.Put(ctx, key, remote); err != nil {
+		return nil, fmt.Errorf("copy %s from shared cache: %w", key, err)
+	}
+	return t.Local.Get(ctx, key)
+}
+
+func (t *Tiered) Put(ctx context.Context, key string, r io.Reader) error {
+	return t.Local.Put(ctx, key, r)
+}
+
+// Publish uploads the Local entry of key to Remote
+func (t *Tiered) Publish(ctx context.Context, key string) error {
+	r, err := t.Local.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := t.Remote.Put(ctx, key, r); err != nil {
+		return fmt.Errorf("publish %s: %w", key, err)
+	}
+	return nil
+}
+
+func (t *Tiered) Exists(ctx context.Context, key string) (bool, error) {
+	if ok, err := t.Local.Exists(ctx, key); ok || err != nil {
+		return ok, err
+	}
+	ok, err := t.Remote.Exists(ctx, key)
+	if err != nil {
+		fmt.Printf("⚠️ Warning: shared cache: %v\n", err)
+		return false, nil
+	}
+	return ok, nil
+}
+
+func (t *Tiered) List(ctx context.Context, prefix string) ([]Entry, error) {
+	return t.Local.List(ctx, prefix)
+}
+
+func (t *Tiered) Delete(ctx context.Context, key string) error {
+	return t.Local.Delete(ctx, key)
+}
+
+func (t *Tiered) Touch(ctx context.Context, key string) error {
+	return touch(ctx, t.Local, key)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -14,17 +15,72 @@ func DefaultEnvValues() map[string]string {
 	year, month, day := now.Date()
 
 	return map[string]string{
-		"AWS_REGION":            "eu-west-3",
-		"AWS_ACCESS_KEY_ID":     "",
-		"AWS_SECRET_ACCESS_KEY": "",
-		"S3_BUCKET_NAME":        "",
-		"S3_PREFIX":             "",
-		"AWS_ACCOUNT_ID":        "",
-		"YEAR":                  fmt.Sprintf("%04d", year),
-		"MONTH":                 fmt.Sprintf("%02d", int(month)),
-		"DAY":                   fmt.Sprintf("%02d", day),
-		"IP_INFO_API_KEY":       "",
-		"NAT_EIPS_LIST":         "", // Comma-separated list of known NAT Gateway EIPs
+		"AWS_REGION":               "eu-west-3",
+		"AWS_ACCESS_KEY_ID":        "",
+		"AWS_SECRET_ACCESS_KEY":    "",
+		"S3_BUCKET_NAME":           "",
+		"S3_PREFIX":                "",
+		"AWS_ACCOUNT_ID":           "",
+		"YEAR":                     fmt.Sprintf("%04d", year),
+		"MONTH":                    fmt.Sprintf("%02d", int(month)),
+		"DAY":                      fmt.Sprintf("%02d", day),
+		"IP_INFO_API_KEY":          "",
+		"NAT_EIPS_LIST":            "", // Comma-separated list of known NAT Gateway EIPs
+		"AWS_IP_RANGES_FILE":       "ip-ranges.json",
+		"ENDPOINT_AZ_COUNT":        "3", // AZs an interface endpoint would be deployed in
+		"OUTPUT_DIR":               ".",
+		"OUTPUT_FORMATS":           "json", // Comma-separated: json, html, csv, ndjson, markdown, openmetrics, sqlite
+		"PAIR_TOP_N":               "5000", // Destination/source pairs kept in results
+		"METRICS_TOP_N":            "50",   // Series per metric before the "other" bucket
+		"METRICS_FILE":             "",     // OpenMetrics output, default <OUTPUT_DIR>/vpc_egress.prom
+		"SERVE_ADDR":               ":9108",
+		"SERVE_REFRESH_INTERVAL":   "1h",
+		"MARKDOWN_TOP_N":           "10",
+		"DIFF_TOP_N":               "10",
+		"ANOMALY_DETECTION":        "false",
+		"HISTORY_DIR":              ".history",
+		"HISTORY_DAYS":             "14",
+		"ANOMALY_MIN_HISTORY_DAYS": "3",
+		"ANOMALY_MAD_K":            "5", // Flag bytes above median + K·MAD
+		"ANOMALY_MIN_GB":           "1",
+		"ANOMALY_NEW_MIN_GB":       "5",
+		// Budgets: a number, or "KEY=value,*=default" lists for per-key budgets
+		"BUDGET_DAILY_COST_USD_WARNING":    "",
+		"BUDGET_DAILY_COST_USD_CRITICAL":   "",
+		"BUDGET_SERVICE_COST_USD_WARNING":  "",
+		"BUDGET_SERVICE_COST_USD_CRITICAL": "",
+		"BUDGET_DESTINATION_GB_WARNING":    "",
+		"BUDGET_DESTINATION_GB_CRITICAL":   "",
+		"BUDGET_SOURCE_GB_WARNING":         "",
+		"BUDGET_SOURCE_GB_CRITICAL":        "",
+		"PREVIOUS_RESULT":                  "", // result.json of an earlier run, for deltas
+		"HOSTNAME_LOOKUP":                  "false",
+		"HOSTNAME_LOOKUP_TOP":              "50",
+		"DNS_RESOLVER":                     "", // host[:port], system resolver when empty
+		"ROUTE53_QUERY_LOGS":               "", // Comma-separated files or directories of Route 53 Resolver query logs
+		"ROUTE53_QUERY_LOG_WINDOW_SECONDS": "3600",
+		"CACHE_DIR":                        "",       // User cache dir ($XDG_CACHE_HOME/vpc-flowlogs-egress-analyzer) when empty
+		"CACHE_MAX_SIZE":                   "",       // e.g. 20GB, least recently used days are evicted above it
+		"CACHE_FORMAT":                     "binary", // binary or json (readable with zcat, for debugging)
+		"CACHE_S3_BUCKET":                  "",       // Shared cache bucket, disabled when empty
+		"CACHE_S3_PREFIX":                  "",
+		"CACHE_S3_ENDPOINT":                "", // e.g. http://minio:9000, AWS when empty
+		"CACHE_S3_REGION":                  "", // AWS_REGION when empty
+		"CACHE_S3_PATH_STYLE":              "false",
+		"CACHE_S3_ACCESS_KEY_ID":           "", // AWS credentials when empty
+		"CACHE_S3_SECRET_ACCESS_KEY":       "",
+		"DOWNLOAD_MAX_RETRIES":             "5",      // Per S3 object, resuming truncated downloads
+		"MAX_FAILED_OBJECTS":               "0",      // Objects allowed to fail before the run fails, they are retried on the next run
+		"DOWNLOAD_CONCURRENCY":             "0",      // S3 downloads in flight, 0 for 4 per CPU, lowered while S3 throttles
+		"PARSE_CONCURRENCY":                "0",      // 0 for one per CPU
+		"WRITE_CONCURRENCY":                "0",      // Cache chunk writers, 0 for one per 2 CPUs
+		"DOWNLOAD_BANDWIDTH":               "",       // Total download rate cap per second, e.g. 20MB
+		"SQLITE_FILE":                      "",       // <OUTPUT_DIR>/egress.sqlite when empty
+		"SQLITE_FLOWS":                     "minute", // minute, records or none
+		"WEBHOOK_URL":                      "",
+		"WEBHOOK_FORMAT":                   "slack", // slack, teams or json
+		"WEBHOOK_DRY_RUN":                  "false",
+		"WEBHOOK_MAX_RETRIES":              "3",
 	}
 }
 
@@ -50,3 +106,27 @@ func GetEnv(key string) string {
 	}
 	return value
 }
+
+func GetEnvInt(key string) int {
+	value := GetEnv(key)
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		if value != "" {
+			log.Printf("Invalid integer for %s: %q, using 0", key, value)
+		}
+		return 0
+	}
+	return n
+}
+
+func GetEnvFloat(key string) float64 {
+	value := GetEnv(key)
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		if value != "" {
+			log.Printf("Invalid number for %s: %q, using 0", key, value)
+		}
+		return 0
+	}
+	return f
+}
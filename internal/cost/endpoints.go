@@ -0,0 +1,154 @@
+package cost
+
+import "strings"
+
+// Interface endpoint (PrivateLink) hourly charge per AZ, in USD
+var InterfaceEndpointHourlyCostPerAZ = map[string]float64{
+	"us-east-1": 0.01,
+	"us-east-2": 0.01,
+	"us-west-1": 0.011,
+	"us-west-2": 0.01,
+
+	"ca-central-1": 0.011,
+	"ca-west-1":    0.011,
+
+	"eu-west-1":    0.011,
+	"eu-west-2":    0.011,
+	"eu-west-3":    0.012,
+	"eu-central-1": 0.012,
+	"eu-central-2": 0.013,
+	"eu-north-1":   0.011,
+	"eu-south-1":   0.012,
+	"eu-south-2":   0.012,
+
+	"me-central-1": 0.013,
+	"me-south-1":   0.013,
+
+	"af-south-1": 0.013,
+
+	"ap-south-1": 0.011,
+	"ap-south-2": 0.011,
+
+	"ap-northeast-1": 0.014,
+	"ap-northeast-2": 0.013,
+	"ap-northeast-3": 0.014,
+
+	"ap-east-1": 0.014,
+
+	"ap-southeast-1": 0.013,
+	"ap-southeast-2": 0.013,
+	"ap-southeast-3": 0.013,
+	"ap-southeast-4": 0.013,
+	"ap-southeast-5": 0.013,
+
+	"sa-east-1": 0.015,
+}
+
+// Interface endpoint data processing, first PB tier
+const InterfaceEndpointDataCostPerGB = 0.01
+
+const defaultInterfaceEndpointHourlyCostPerAZ = 0.01
+
+const HoursPerMonth = 730
+
+const (
+	EndpointGateway     = "gateway"
+	EndpointInterface   = "interface"
+	EndpointInvestigate = "investigate"
+	EndpointCrossRegion = "cross_region"
+)
+
+type Endpoint struct {
+	Type     string
+	Services []string // VPC endpoint service suffixes, e.g. "ecr.api"
+	Note     string
+}
+
+// Endpoints maps AWS service names to the VPC endpoints that keep that traffic off the NAT
+// Gateway. pkt-dst-aws-service and ip-ranges.json only name S3, DynamoDB and a few others,
+// API traffic shows up as AMAZON or EC2: the other keys come from hostnames, see
+// ServiceFromHostname.
+var Endpoints = map[string]Endpoint{
+	"S3":       {Type: EndpointGateway, Services: []string{"s3"}, Note: "Gateway endpoints are free, add it to the private subnets route tables."},
+	"DYNAMODB": {Type: EndpointGateway, Services: []string{"dynamodb"}, Note: "Gateway endpoints are free, add it to the private subnets route tables."},
+
+	"EC2_API":               {Type: EndpointInterface, Services: []string{"ec2"}, Note: "EC2 API calls, identified by hostname."},
+	"ECR":                   {Type: EndpointInterface, Services: []string{"ecr.api", "ecr.dkr"}, Note: "Image layers are served from S3, add the S3 gateway endpoint too."},
+	"STS":                   {Type: EndpointInterface, Services: []string{"sts"}},
+	"SQS":                   {Type: EndpointInterface, Services: []string{"sqs"}},
+	"SNS":                   {Type: EndpointInterface, Services: []string{"sns"}},
+	"LOGS":                  {Type: EndpointInterface, Services: []string{"logs"}},
+	"MONITORING":            {Type: EndpointInterface, Services: []string{"monitoring"}},
+	"KMS":                   {Type: EndpointInterface, Services: []string{"kms"}},
+	"SECRETSMANAGER":        {Type: EndpointInterface, Services: []string{"secretsmanager"}},
+	"SSM":                   {Type: EndpointInterface, Services: []string{"ssm", "ssmmessages", "ec2messages"}},
+	"KINESIS":               {Type: EndpointInterface, Services: []string{"kinesis-streams"}},
+	"KINESIS_VIDEO_STREAMS": {Type: EndpointInterface, Services: []string{"kinesisvideo"}},
+	"API_GATEWAY":           {Type: EndpointInterface, Services: []string{"execute-api"}, Note: "Only applies to private APIs."},
+	"CODEBUILD":             {Type: EndpointInterface, Services: []string{"codebuild"}},
+	"EBS":                   {Type: EndpointInterface, Services: []string{"ebs"}},
+
+	// Savings cannot be estimated: most of this range is other customers' public addresses
+	"EC2":    {Type: EndpointInvestigate, Services: []string{"ec2"}, Note: "The EC2 range holds every customer's public instances and Elastic IPs: only EC2 API calls can use the ec2 interface endpoint, check what these destinations are before adding one."},
+	"AMAZON": {Type: EndpointInvestigate, Note: "Generic AWS range: identify the API (ECR, STS, SQS, CloudWatch Logs...) before adding an interface endpoint."},
+}
+
+func InterfaceEndpointHourlyCost(region string) float64 {
+	if c, ok := InterfaceEndpointHourlyCostPerAZ[region]; ok {
+		return c
+	}
+	return defaultInterfaceEndpointHourlyCostPerAZ
+}
+
+// apiHostServices maps the service label of AWS API hostnames
+// (<service>.<region>.amazonaws.com, bucket.s3.<region>.amazonaws.com, <account>.dkr.ecr...)
+// to Endpoints keys
+var apiHostServices = map[string]string{
+	"s3":             "S3",
+	"dynamodb":       "DYNAMODB",
+	"ec2":            "EC2_API",
+	"ecr":            "ECR",
+	"sts":            "STS",
+	"sqs":            "SQS",
+	"sns":            "SNS",
+	"logs":           "LOGS",
+	"monitoring":     "MONITORING",
+	"kms":            "KMS",
+	"secretsmanager": "SECRETSMANAGER",
+	"ssm":            "SSM",
+	"ssmmessages":    "SSM",
+	"ec2messages":    "SSM",
+	"kinesis":        "KINESIS",
+	"kinesisvideo":   "KINESIS_VIDEO_STREAMS",
+	"execute-api":    "API_GATEWAY",
+	"codebuild":      "CODEBUILD",
+	"ebs":            "EBS",
+}
+
+// ServiceFromHostname returns the Endpoints key of an AWS API hostname, or "" for any other
+// name, EC2 instance names (ec2-1-2-3-4.<region>.compute.amazonaws.com, compute-1 in
+// us-east-1) included. Labels are read right to left so a bucket or account label never
+// shadows the service.
+func ServiceFromHostname(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	rest, ok := strings.CutSuffix(host, ".amazonaws.com")
+	if !ok {
+		return ""
+	}
+
+	labels := strings.Split(rest, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		label := labels[i]
+		if strings.HasPrefix(label, "compute") {
+			return ""
+		}
+		if service, ok := apiHostServices[label]; ok {
+			return service
+		}
+		// Legacy S3 names: s3-eu-west-1, s3-external-1
+		if strings.HasPrefix(label, "s3-") {
+			return "S3"
+		}
+	}
+	return ""
+}
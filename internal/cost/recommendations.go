@@ -0,0 +1,107 @@
+package cost
+
+import (
+	"fmt"
+	"sort"
+)
+
+type ServiceUsage struct {
+	Service string
+	Region  string // destination region, empty when unknown
+	GB      float64
+}
+
+type Recommendation struct {
+	Service                string   `json:"service"`
+	Region                 string   `json:"region,omitempty"`
+	CrossRegion            bool     `json:"cross_region"`
+	EndpointType           string   `json:"endpoint_type"`
+	EndpointServices       []string `json:"endpoint_services,omitempty"`
+	GBPerMonth             float64  `json:"gb_per_month"`
+	NatCostMonthlyUSD      float64  `json:"nat_cost_monthly_usd"`
+	EndpointCostMonthlyUSD float64  `json:"endpoint_cost_monthly_usd"`
+	NetSavingsMonthlyUSD   float64  `json:"net_savings_monthly_usd"`
+	Note                   string   `json:"note,omitempty"`
+}
+
+// Recommend proposes a VPC endpoint for every AWS service seen through the NAT Gateway.
+// Usage covers `days` days of logs, a fraction for a day still in progress, and is
+// extrapolated to a 30 days month.
+// Cross-region traffic cannot use a local endpoint and gets its own recommendation.
+// Recommendations are sorted by net monthly savings, cross-region and investigations last.
+func Recommend(region string, usage []ServiceUsage, days float64, azCount int) []Recommendation {
+	if days <= 0 {
+		days = 1
+	}
+	natPerGB := NatDataProcessedCostPerGB[region]
+
+	recs := make([]Recommendation, 0, len(usage))
+	for _, u := range usage {
+		endpoint, ok := Endpoints[u.Service]
+		if !ok {
+			continue
+		}
+
+		gbMonth := u.GB * 30 / days
+		rec := Recommendation{
+			Service:           u.Service,
+			Region:            u.Region,
+			EndpointType:      endpoint.Type,
+			GBPerMonth:        gbMonth,
+			NatCostMonthlyUSD: gbMonth * natPerGB,
+			Note:              endpoint.Note,
+		}
+
+		rec.CrossRegion = CrossRegion(region, u.Region)
+		if rec.CrossRegion && endpoint.Type != EndpointInvestigate {
+			rec.EndpointType = EndpointCrossRegion
+			rec.Note = crossRegionNote(u.Service, region, u.Region, endpoint.Type)
+			recs = append(recs, rec)
+			continue
+		}
+		for _, s := range endpoint.Services {
+			rec.EndpointServices = append(rec.EndpointServices, fmt.Sprintf("com.amazonaws.%s.%s", region, s))
+		}
+
+		switch endpoint.Type {
+		case EndpointGateway:
+			rec.EndpointCostMonthlyUSD = 0
+		case EndpointInterface:
+			hourly := InterfaceEndpointHourlyCost(region) * float64(azCount*len(endpoint.Services))
+			rec.EndpointCostMonthlyUSD = hourly*HoursPerMonth + gbMonth*InterfaceEndpointDataCostPerGB
+		case EndpointInvestigate:
+			recs = append(recs, rec)
+			continue
+		}
+		rec.NetSavingsMonthlyUSD = rec.NatCostMonthlyUSD - rec.EndpointCostMonthlyUSD
+
+		recs = append(recs, rec)
+	}
+
+	sort.SliceStable(recs, func(i, j int) bool {
+		iActionable := recs[i].EndpointType == EndpointGateway || recs[i].EndpointType == EndpointInterface
+		jActionable := recs[j].EndpointType == EndpointGateway || recs[j].EndpointType == EndpointInterface
+		if iActionable != jActionable {
+			return iActionable
+		}
+		if recs[i].NetSavingsMonthlyUSD != recs[j].NetSavingsMonthlyUSD {
+			return recs[i].NetSavingsMonthlyUSD > recs[j].NetSavingsMonthlyUSD
+		}
+		return recs[i].NatCostMonthlyUSD > recs[j].NatCostMonthlyUSD
+	})
+
+	return recs
+}
+
+// CrossRegion reports whether dest is a known region other than home. GLOBAL services
+// (CloudFront, Route 53...) are not tied to a region.
+func CrossRegion(home, dest string) bool {
+	return dest != "" && dest != "GLOBAL" && dest != home
+}
+
+func crossRegionNote(service, home, dest, endpointType string) string {
+	if endpointType == EndpointGateway {
+		return fmt.Sprintf("%s in %s is not reachable through a %s gateway endpoint. Move or replicate the data to %s, or keep it in %s and accept NAT + inter-region transfer.", service, dest, home, home, dest)
+	}
+	return fmt.Sprintf("%s calls go to %s. Use the %s regional API with a local interface endpoint, or reach a %s endpoint over inter-region peering.", service, dest, home, dest)
+}
@@ -0,0 +1,207 @@
+package cost
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRecommend(t *testing.T) {
+	const region = "eu-west-3"
+	nat := NatDataProcessedCostPerGB[region]
+	hourly := InterfaceEndpointHourlyCost(region)
+
+	cases := []struct {
+		name     string
+		usage    ServiceUsage
+		days     float64
+		azCount  int
+		endpoint string
+		services int
+		natCost  float64
+		endpCost float64
+		savings  float64
+	}{
+		{
+			name:     "gateway",
+			usage:    ServiceUsage{Service: "S3", Region: region, GB: 10},
+			days:     1,
+			azCount:  2,
+			endpoint: EndpointGateway,
+			services: 1,
+			natCost:  300 * nat,
+			savings:  300 * nat,
+		},
+		{
+			name:     "interface",
+			usage:    ServiceUsage{Service: "STS", Region: region, GB: 100},
+			days:     1,
+			azCount:  2,
+			endpoint: EndpointInterface,
+			services: 1,
+			natCost:  3000 * nat,
+			endpCost: 2*hourly*HoursPerMonth + 3000*InterfaceEndpointDataCostPerGB,
+			savings:  3000*nat - 2*hourly*HoursPerMonth - 3000*InterfaceEndpointDataCostPerGB,
+		},
+		{
+			name:     "interface per endpoint service",
+			usage:    ServiceUsage{Service: "ECR", Region: region, GB: 1},
+			days:     1,
+			azCount:  3,
+			endpoint: EndpointInterface,
+			services: 2,
+			natCost:  30 * nat,
+			endpCost: 6*hourly*HoursPerMonth + 30*InterfaceEndpointDataCostPerGB,
+			savings:  30*nat - 6*hourly*HoursPerMonth - 30*InterfaceEndpointDataCostPerGB,
+		},
+		{
+			name:     "partial day is extrapolated from its span",
+			usage:    ServiceUsage{Service: "S3", Region: region, GB: 10},
+			days:     0.25,
+			azCount:  2,
+			endpoint: EndpointGateway,
+			services: 1,
+			natCost:  1200 * nat,
+			savings:  1200 * nat,
+		},
+		{
+			name:     "investigate generic range",
+			usage:    ServiceUsage{Service: "AMAZON", Region: region, GB: 10},
+			days:     1,
+			azCount:  2,
+			endpoint: EndpointInvestigate,
+			natCost:  300 * nat,
+		},
+		{
+			name:     "investigate EC2 without savings",
+			usage:    ServiceUsage{Service: "EC2", Region: region, GB: 1000},
+			days:     1,
+			azCount:  2,
+			endpoint: EndpointInvestigate,
+			services: 1,
+			natCost:  30000 * nat,
+		},
+		{
+			name:     "investigate stays for other regions",
+			usage:    ServiceUsage{Service: "AMAZON", Region: "us-east-1", GB: 10},
+			days:     1,
+			azCount:  2,
+			endpoint: EndpointInvestigate,
+			natCost:  300 * nat,
+		},
+		{
+			name:     "cross-region gateway",
+			usage:    ServiceUsage{Service: "S3", Region: "us-east-1", GB: 10},
+			days:     1,
+			azCount:  2,
+			endpoint: EndpointCrossRegion,
+			natCost:  300 * nat,
+		},
+		{
+			name:     "cross-region interface",
+			usage:    ServiceUsage{Service: "SQS", Region: "us-east-1", GB: 10},
+			days:     1,
+			azCount:  2,
+			endpoint: EndpointCrossRegion,
+			natCost:  300 * nat,
+		},
+		{
+			name:     "global service is not cross-region",
+			usage:    ServiceUsage{Service: "S3", Region: "GLOBAL", GB: 10},
+			days:     1,
+			azCount:  2,
+			endpoint: EndpointGateway,
+			services: 1,
+			natCost:  300 * nat,
+			savings:  300 * nat,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			recs := Recommend(region, []ServiceUsage{c.usage}, c.days, c.azCount)
+			if len(recs) != 1 {
+				t.Fatalf("got %d recommendations, expected 1", len(recs))
+			}
+			r := recs[0]
+			if r.EndpointType != c.endpoint {
+				t.Errorf("endpoint type %q, expected %q", r.EndpointType, c.endpoint)
+			}
+			if r.CrossRegion != (c.endpoint == EndpointCrossRegion) && c.endpoint != EndpointInvestigate {
+				t.Errorf("cross region %t for endpoint type %q", r.CrossRegion, c.endpoint)
+			}
+			if len(r.EndpointServices) != c.services {
+				t.Errorf("endpoint services %v, expected %d", r.EndpointServices, c.services)
+			}
+			for _, check := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"nat cost", r.NatCostMonthlyUSD, c.natCost},
+				{"endpoint cost", r.EndpointCostMonthlyUSD, c.endpCost},
+				{"net savings", r.NetSavingsMonthlyUSD, c.savings},
+			} {
+				if math.Abs(check.got-check.want) > 1e-9 {
+					t.Errorf("%s %.4f, expected %.4f", check.name, check.got, check.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRecommendSkipsUnknownServicesAndSorts(t *testing.T) {
+	recs := Recommend("eu-west-3", []ServiceUsage{
+		{Service: "CLOUDFRONT", Region: "GLOBAL", GB: 500},
+		{Service: "AMAZON", Region: "eu-west-3", GB: 900},
+		{Service: "S3", Region: "us-east-1", GB: 800},
+		{Service: "DYNAMODB", Region: "eu-west-3", GB: 1},
+		{Service: "S3", Region: "eu-west-3", GB: 50},
+	}, 1, 2)
+
+	var got []string
+	for _, r := range recs {
+		got = append(got, r.Service+"/"+r.EndpointType)
+	}
+	want := []string{"S3/gateway", "DYNAMODB/gateway", "AMAZON/investigate", "S3/cross_region"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, expected %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, expected actionable recommendations first by savings: %v", got, want)
+		}
+	}
+}
+
+func TestServiceFromHostname(t *testing.T) {
+	cases := map[string]string{
+		"sts.eu-west-3.amazonaws.com":                    "STS",
+		"sts.amazonaws.com.":                             "STS",
+		"api.ecr.eu-west-3.amazonaws.com":                "ECR",
+		"123456789012.dkr.ecr.eu-west-3.amazonaws.com":   "ECR",
+		"my-bucket.s3.eu-west-3.amazonaws.com":           "S3",
+		"sqs.s3.eu-west-3.amazonaws.com":                 "S3",
+		"s3-external-1.amazonaws.com":                    "S3",
+		"logs.eu-west-3.amazonaws.com":                   "LOGS",
+		"ssmmessages.eu-west-3.amazonaws.com":            "SSM",
+		"abcdef.execute-api.eu-west-3.amazonaws.com":     "API_GATEWAY",
+		"ec2.eu-west-3.amazonaws.com":                    "EC2_API",
+		"ec2-15-188-1-2.eu-west-3.compute.amazonaws.com": "",
+		"ec2-3-80-1-2.compute-1.amazonaws.com":           "",
+		"dynamodb.eu-west-3.amazonaws.com":               "DYNAMODB",
+		"api.github.com":                                 "",
+		"d111111abcdef8.cloudfront.net":                  "",
+		"unknown-service.eu-west-3.amazonaws.com":        "",
+		"monitoring.eu-west-3.amazonaws.com.example.com": "",
+	}
+	for host, want := range cases {
+		if got := ServiceFromHostname(host); got != want {
+			t.Errorf("ServiceFromHostname(%q) = %q, expected %q", host, got, want)
+		}
+		if want == "" {
+			continue
+		}
+		if _, ok := Endpoints[want]; !ok {
+			t.Errorf("%q maps to %q, which has no endpoint", host, want)
+		}
+	}
+}
@@ -1,29 +1,86 @@
 package flow_logs
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os"
 	"sort"
+	"time"
+	"vpc_flowlogs_egress_analyzer/internal/budget"
+	"vpc_flowlogs_egress_analyzer/internal/cache"
+	"vpc_flowlogs_egress_analyzer/internal/config"
 	"vpc_flowlogs_egress_analyzer/internal/cost"
+	"vpc_flowlogs_egress_analyzer/internal/history"
+	"vpc_flowlogs_egress_analyzer/internal/hostnames"
 	"vpc_flowlogs_egress_analyzer/internal/ipInfo"
+	"vpc_flowlogs_egress_analyzer/internal/ipRanges"
+	"vpc_flowlogs_egress_analyzer/internal/report"
 )
 
-func Analyze() {
-	logs, err := RetrieveVPCFlowLogs()
+// analysis is an analyzed day with what recording it needs besides the report
+type analysis struct {
+	summary  AnalysisSummary
+	report   report.Report
+	logs     []VPCFlowLogRecord
+	complete bool
+}
+
+// Analyze analyzes the configured day and records it: output files, anomaly history and the
+// printed summary
+func Analyze() (report.Report, error) {
+	a, err := analyze(needsRecords(), true)
+	if err != nil {
+		return report.Report{}, err
+	}
+
+	if config.GetEnv("ANOMALY_DETECTION") == "true" {
+		recordHistory(a.report, a.complete)
+	}
+	writeOutputs(a.report, a.logs)
+	printAnalysisSummary(a.summary)
+	printAnomalies(a.report.Anomalies)
+	budget.Print(a.report.BudgetViolations)
+	return a.report, nil
+}
+
+// AnalyzeReport analyzes the configured day without recording anything, for serve mode which
+// refreshes it on every interval. Destinations are not enriched with ipinfo.io, which metrics
+// do not export.
+func AnalyzeReport() (report.Report, error) {
+	a, err := analyze(false, false)
+	return a.report, err
+}
+
+func analyze(withRecords, enrich bool) (analysis, error) {
+	var logs []VPCFlowLogRecord
+	var rows []RollupRow
+	var complete bool
+	ctx := context.TODO()
+	store, err := OpenCache()
+	if err == nil && withRecords {
+		logs, complete, err = RetrieveVPCFlowLogs(ctx, store)
+		rows = buildRollup(logs)
+	} else if err == nil {
+		rows, complete, err = RetrieveEgressRollup(ctx, store)
+	}
 	if err != nil {
-		panic(fmt.Sprintf("CRITICAL: %v", err))
+		return analysis{}, err
 	}
 
 	_, _, region, _, day, month, year, _ := getFlowLogConfig()
 
 	summary := AnalysisSummary{
-		Year:   year,
-		Month:  month,
-		Day:    day,
-		ByIP:   make(map[string]*IPStats),
-		Region: region,
+		Year:       year,
+		Month:      month,
+		Day:        day,
+		ByIP:       make(map[string]*IPStats),
+		ByProtocol: make(map[int]*TrafficStats),
+		ByPort:     make(map[int]*TrafficStats),
+		BySource:   make(map[string]*SourceStats),
+		ByHour:     make(map[int64]*TrafficStats),
+		ByPair:     make(map[PairKey]*TrafficStats),
+		Region:     region,
 	}
 
 	costPerGB := cost.NatDataProcessedCostPerGB[region]
@@ -33,115 +90,276 @@ func Analyze() {
 
 	fmt.Println("🔍 Analyzing traffic patterns...")
 
-	for _, r := range logs {
-		if r.Direction != "egress" {
-			continue
-		}
-
+	for _, r := range rows {
 		bytes := r.Bytes
 		gb := float64(bytes) / (1024 * 1024 * 1024)
 		costUSD := gb * costPerGB
 
-		ip := r.PktDstAddr
-		if ip == "" || ip == "-" {
-			ip = r.DstAddr
-		}
+		ip := r.Destination
 
 		if _, exists := summary.ByIP[ip]; !exists {
-			summary.ByIP[ip] = &IPStats{Direction: "egress"}
+			summary.ByIP[ip] = &IPStats{Direction: "egress", Ports: make(map[int]*TrafficStats)}
 		}
 
 		stat := summary.ByIP[ip]
 		stat.Bytes += bytes
 		stat.GB += gb
 		stat.CostUSD += costUSD
-		stat.ConnectionNum++
+		stat.ConnectionNum += r.Flows
 
-		if r.PktDstAwsService != "-" && r.PktDstAwsService != "" {
-			stat.AwsService = r.PktDstAwsService
+		if stat.FirstSeen == 0 || r.FirstSeen < stat.FirstSeen {
+			stat.FirstSeen = r.FirstSeen
+		}
+		if r.LastSeen > stat.LastSeen {
+			stat.LastSeen = r.LastSeen
+		}
+
+		if r.Service != "" {
+			stat.AwsService = r.Service
+		}
+
+		src := r.Source
+		if _, exists := summary.BySource[src]; !exists {
+			summary.BySource[src] = &SourceStats{Interfaces: make(map[string]int)}
+		}
+		summary.BySource[src].Add(bytes, gb, costUSD, r.Flows)
+		summary.BySource[src].Interfaces[r.InterfaceID] += bytes
+
+		pair := PairKey{Destination: ip, Source: src, InterfaceID: r.InterfaceID}
+		if _, exists := summary.ByPair[pair]; !exists {
+			summary.ByPair[pair] = &TrafficStats{}
+		}
+		summary.ByPair[pair].Add(bytes, gb, costUSD, r.Flows)
+
+		if _, exists := summary.ByHour[r.Hour]; !exists {
+			summary.ByHour[r.Hour] = &TrafficStats{}
+		}
+		summary.ByHour[r.Hour].Add(bytes, gb, costUSD, r.Flows)
+
+		if _, exists := summary.ByProtocol[r.Protocol]; !exists {
+			summary.ByProtocol[r.Protocol] = &TrafficStats{}
+		}
+		summary.ByProtocol[r.Protocol].Add(bytes, gb, costUSD, r.Flows)
+
+		if HasPorts(r.Protocol) {
+			if _, exists := summary.ByPort[r.Port]; !exists {
+				summary.ByPort[r.Port] = &TrafficStats{}
+			}
+			summary.ByPort[r.Port].Add(bytes, gb, costUSD, r.Flows)
+
+			if _, exists := stat.Ports[r.Port]; !exists {
+				stat.Ports[r.Port] = &TrafficStats{}
+			}
+			stat.Ports[r.Port].Add(bytes, gb, costUSD, r.Flows)
 		}
 
 		totalBytes += bytes
 	}
 
-	summary.Total.Bytes = totalBytes
-	summary.Total.GB = float64(totalBytes) / (1024 * 1024 * 1024)
-	summary.Total.CostUSD = summary.Total.GB * costPerGB
-
 	ips := make([]string, 0, len(summary.ByIP))
 	for ip := range summary.ByIP {
 		ips = append(ips, ip)
 	}
 	sort.Slice(ips, func(i, j int) bool {
-		return summary.ByIP[ips[i]].GB > summary.ByIP[ips[j]].GB
+		bi, bj := summary.ByIP[ips[i]].Bytes, summary.ByIP[ips[j]].Bytes
+		if bi != bj {
+			return bi > bj
+		}
+		return ips[i] < ips[j]
 	})
 
+	// Hostnames come first: they name the AWS APIs that ip-ranges.json calls AMAZON or EC2
+	if hostnames.Enabled() {
+		resolveHostnames(store, summary.ByIP, ips)
+	}
+	tagAwsDestinations(summary.ByIP)
+	tagApiHostnames(summary.ByIP)
+	summary.ByService = aggregateByService(summary.ByIP)
+	summary.AwsScope = aggregateRegionScope(summary.ByService, region)
+	date := fmt.Sprintf("%s-%s-%s", year, month, day)
+	summary.Recommendations = cost.Recommend(region, serviceUsage(summary.ByService), analyzedDays(date, time.Now()), config.GetEnvInt("ENDPOINT_AZ_COUNT"))
+
+	summary.Total.Bytes = totalBytes
+	summary.Total.GB = float64(totalBytes) / (1024 * 1024 * 1024)
+	summary.Total.CostUSD = summary.Total.GB * costPerGB
+
+	if enrich {
+		enrichIpInfo(summary.ByIP, ips)
+	}
+
+	rep := buildReport(summary)
+	if config.GetEnv("ANOMALY_DETECTION") == "true" {
+		rep.Anomalies = detectAnomalies(rep)
+	}
+	rep.BudgetViolations = budget.Evaluate(rep, budget.FromEnv())
+
+	return analysis{summary: summary, report: rep, logs: logs, complete: complete}, nil
+}
+
+func enrichIpInfo(byIP map[string]*IPStats, sortedIPs []string) {
 	topLimit := 50
-	if len(ips) < topLimit {
-		topLimit = len(ips)
+	if len(sortedIPs) < topLimit {
+		topLimit = len(sortedIPs)
 	}
 
 	fmt.Printf("🌍 Enriching top %d IPs with geo/ASN data...\n", topLimit)
-	for i := 0; i < topLimit; i++ {
-		ip := ips[i]
+	for _, ip := range sortedIPs[:topLimit] {
 		info, err := ipInfo.GetIpInfo(ip)
 		if err == nil {
-			summary.ByIP[ip].IpInfo = info
+			byIP[ip].IpInfo = info
 		} else {
 			log.Printf("⚠️ Warning: failed to get IpInfo for %s: %v", ip, err)
 		}
 	}
+}
+
+func resolveHostnames(store cache.Cache, byIP map[string]*IPStats, sortedIPs []string) {
+	limit := config.GetEnvInt("HOSTNAME_LOOKUP_TOP")
+	if limit <= 0 || limit > len(sortedIPs) {
+		limit = len(sortedIPs)
+	}
+
+	fmt.Printf("🏷️ Resolving hostnames for top %d IPs...\n", limit)
+	targets := make([]hostnames.Target, 0, limit)
+	for _, ip := range sortedIPs[:limit] {
+		st := byIP[ip]
+		targets = append(targets, hostnames.Target{IP: ip, FirstSeen: st.FirstSeen, LastSeen: st.LastSeen})
+	}
+
+	for ip, res := range hostnames.Resolve(store, targets) {
+		r := res
+		byIP[ip].Hostname = &r
+	}
+}
 
-	saveAnalysisToFile(summary)
-	printAnalysisSummary(summary)
+func historyStore(region string) *history.Store {
+	return history.NewStore(config.GetEnv("HISTORY_DIR"), region, config.GetEnvInt("HISTORY_DAYS"))
 }
 
-func saveAnalysisToFile(summary AnalysisSummary) {
-	entries := make([]IPEntry, 0, len(summary.ByIP))
-	for ip, st := range summary.ByIP {
-		entries = append(entries, IPEntry{
-			IP:            ip,
-			AwsService:    st.AwsService,
-			Direction:     st.Direction,
-			Bytes:         st.Bytes,
-			GB:            st.GB,
-			CostUSD:       st.CostUSD,
-			ConnectionNum: st.ConnectionNum,
-			IpInfo:        st.IpInfo,
-		})
+// detectAnomalies compares the run with the rolling history
+func detectAnomalies(rep report.Report) []report.Anomaly {
+	current := history.SnapshotFromReport(rep)
+	past, err := historyStore(rep.Region).Before(current.Date)
+	if err != nil {
+		log.Printf("⚠️ Warning: anomaly detection skipped: %v", err)
+		return nil
 	}
 
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].GB > entries[j].GB
+	const bytesPerGB = 1024 * 1024 * 1024
+	anomalies := history.Detect(current, past, history.DetectOptions{
+		K:              config.GetEnvFloat("ANOMALY_MAD_K"),
+		MinHistoryDays: config.GetEnvInt("ANOMALY_MIN_HISTORY_DAYS"),
+		MinBytes:       int(config.GetEnvFloat("ANOMALY_MIN_GB") * bytesPerGB),
+		NewMinBytes:    int(config.GetEnvFloat("ANOMALY_NEW_MIN_GB") * bytesPerGB),
 	})
+	fmt.Printf("📈 Compared with %d days of history, %d anomalies\n", len(past), len(anomalies))
+	return anomalies
+}
 
-	out := map[string]any{
-		"year":            summary.Year,
-		"month":           summary.Month,
-		"day":             summary.Day,
-		"region":          summary.Region,
-		"cost_per_gb_usd": summary.CostPerGBUSD,
-		"total": map[string]any{
-			"bytes":    summary.Total.Bytes,
-			"gb":       summary.Total.GB,
-			"cost_usd": summary.Total.CostUSD,
-		},
-		"egress_by_ip": entries,
-	}
-
-	j, err := json.MarshalIndent(out, "", "  ")
-	if err != nil {
-		fmt.Println("❌ Error marshaling JSON:", err)
+// recordHistory adds the run to the rolling history when the day is complete: a partial day
+// would lower the baselines
+func recordHistory(rep report.Report, complete bool) {
+	current := history.SnapshotFromReport(rep)
+	if !complete {
+		fmt.Printf("📈 %s is incomplete, not recorded in the history\n", current.Date)
 		return
 	}
+	if err := historyStore(rep.Region).Save(current); errors.Is(err, history.ErrOutsideWindow) {
+		fmt.Printf("📈 Not recorded in the history: %v\n", err)
+	} else if err != nil {
+		log.Printf("⚠️ Warning: failed to save history: %v", err)
+	}
+}
 
-	err = os.WriteFile("result.json", j, 0644)
-	if err != nil {
-		fmt.Println("❌ Error writing result.json:", err)
+// tagApiHostnames names the AWS API behind generic AMAZON and EC2 destinations from their
+// hostname, so interface endpoints can be recommended for it
+func tagApiHostnames(byIP map[string]*IPStats) {
+	for _, st := range byIP {
+		if st.Hostname == nil || (st.AwsService != "" && st.AwsService != "AMAZON" && st.AwsService != "EC2") {
+			continue
+		}
+		names := append([]string{st.Hostname.Hostname}, st.Hostname.QueryNames...)
+		for _, name := range names {
+			if service := cost.ServiceFromHostname(name); service != "" {
+				st.AwsService = service
+				break
+			}
+		}
+	}
+}
+
+// analyzedDays is the span of the logs in days: a past day is whole, today only counts the
+// hours elapsed so far
+func analyzedDays(date string, now time.Time) float64 {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil || dayComplete(date, now) {
+		return 1
+	}
+	return min(max(now.Sub(day).Hours()/24, 1.0/24), 1)
+}
+
+// tagAwsDestinations fills service and region from ip-ranges.json, which covers
+// older log formats and services in other regions that pkt-dst-aws-service misses
+func tagAwsDestinations(byIP map[string]*IPStats) {
+	ranges := ipRanges.Get()
+	if ranges == nil {
 		return
 	}
 
-	fmt.Println("💾 Saved detailed analysis to result.json")
+	tagged := 0
+	for ip, st := range byIP {
+		match, ok := ranges.Lookup(ip)
+		if !ok {
+			continue
+		}
+		if st.AwsService == "" {
+			st.AwsService = match.Service
+			tagged++
+		}
+		st.AwsRegion = match.Region
+	}
+	fmt.Printf("🗺️ Tagged %d destinations as AWS services from IP ranges\n", tagged)
+}
+
+func aggregateByService(byIP map[string]*IPStats) map[ServiceKey]*TrafficStats {
+	byService := make(map[ServiceKey]*TrafficStats)
+	for _, st := range byIP {
+		if st.AwsService == "" {
+			continue
+		}
+		key := ServiceKey{Service: st.AwsService, Region: st.AwsRegion}
+		if _, exists := byService[key]; !exists {
+			byService[key] = &TrafficStats{}
+		}
+		byService[key].Bytes += st.Bytes
+		byService[key].GB += st.GB
+		byService[key].CostUSD += st.CostUSD
+		byService[key].ConnectionNum += st.ConnectionNum
+	}
+	return byService
+}
+
+func aggregateRegionScope(byService map[ServiceKey]*TrafficStats, region string) AwsRegionScope {
+	var scope AwsRegionScope
+	for key, st := range byService {
+		switch {
+		case key.Region == "":
+			scope.UnknownRegion.Merge(st)
+		case cost.CrossRegion(region, key.Region):
+			scope.CrossRegion.Merge(st)
+		default:
+			scope.InRegion.Merge(st)
+		}
+	}
+	return scope
+}
+
+func serviceUsage(byService map[ServiceKey]*TrafficStats) []cost.ServiceUsage {
+	usage := make([]cost.ServiceUsage, 0, len(byService))
+	for key, st := range byService {
+		usage = append(usage, cost.ServiceUsage{Service: key.Service, Region: key.Region, GB: st.GB})
+	}
+	return usage
 }
 
 func printAnalysisSummary(s AnalysisSummary) {
@@ -156,7 +374,92 @@ func printAnalysisSummary(s AnalysisSummary) {
 	fmt.Printf("🎯 Unique Destination IPs:     %d\n", totalIPs)
 
 	fmt.Println("-----------------------------------------------------------------")
-	fmt.Println("💡 Optimization Hint: Look for 'S3' or 'DYNAMODB' in result.json")
-	fmt.Println("   Use Gateway Endpoints (free) instead of NAT (paid) for these.")
+	fmt.Println("🏆 Top Destinations:")
+	for _, ip := range topIPs(s.ByIP, 10) {
+		st := s.ByIP[ip]
+		label := st.AwsService
+		if st.Hostname != nil {
+			label = st.Hostname.Hostname
+		}
+		fmt.Printf("   %-39s %10.2f GB   $%-8.2f %s\n", ip, st.GB, st.CostUSD, label)
+	}
+
+	fmt.Println("-----------------------------------------------------------------")
+	fmt.Println("🔌 Egress by Protocol:")
+	for _, p := range protocolEntries(s.ByProtocol) {
+		fmt.Printf("   %-8s %10.2f GB   $%.2f\n", p.Protocol, p.GB, p.CostUSD)
+	}
+
+	fmt.Println("🚪 Top Destination Ports:")
+	for _, p := range topPorts(s.ByPort, 10) {
+		fmt.Printf("   %-6d %-16s %10.2f GB   $%.2f\n", p.Port, p.Service, p.GB, p.CostUSD)
+	}
+
+	fmt.Println("-----------------------------------------------------------------")
+	fmt.Println("☁️ AWS Service Traffic through NAT:")
+	fmt.Printf("   %-24s %10.2f GB   $%.2f\n", "In-region ("+s.Region+"):", s.AwsScope.InRegion.GB, s.AwsScope.InRegion.CostUSD)
+	fmt.Printf("   %-24s %10.2f GB   $%.2f\n", "Cross-region:", s.AwsScope.CrossRegion.GB, s.AwsScope.CrossRegion.CostUSD)
+	if s.AwsScope.UnknownRegion.Bytes > 0 {
+		fmt.Printf("   %-24s %10.2f GB   $%.2f\n", "Unknown region:", s.AwsScope.UnknownRegion.GB, s.AwsScope.UnknownRegion.CostUSD)
+	}
+
+	fmt.Println("-----------------------------------------------------------------")
+	printRecommendations(s.Recommendations)
+	fmt.Println("=================================================================")
+}
+
+func topIPs(byIP map[string]*IPStats, limit int) []string {
+	ips := make([]string, 0, len(byIP))
+	for ip := range byIP {
+		ips = append(ips, ip)
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		if byIP[ips[i]].Bytes != byIP[ips[j]].Bytes {
+			return byIP[ips[i]].Bytes > byIP[ips[j]].Bytes
+		}
+		return ips[i] < ips[j]
+	})
+	if limit > 0 && len(ips) > limit {
+		ips = ips[:limit]
+	}
+	return ips
+}
+
+func printRecommendations(recs []cost.Recommendation) {
+	if len(recs) == 0 {
+		fmt.Println("💡 No AWS service traffic detected through NAT.")
+		return
+	}
+
+	fmt.Println("💡 VPC Endpoint Recommendations (monthly estimates):")
+	for i, r := range recs {
+		switch r.EndpointType {
+		case cost.EndpointCrossRegion:
+			fmt.Printf("   %d. 🌐 %s in %s (cross-region): $%.2f/month through NAT. %s\n", i+1, r.Service, r.Region, r.NatCostMonthlyUSD, r.Note)
+		case cost.EndpointInvestigate:
+			fmt.Printf("   %d. 🔎 %s: $%.2f/month through NAT. %s\n", i+1, r.Service, r.NatCostMonthlyUSD, r.Note)
+		default:
+			fmt.Printf("   %d. %s → %s endpoint: NAT $%.2f vs endpoint $%.2f, saves $%.2f/month\n",
+				i+1, r.Service, r.EndpointType, r.NatCostMonthlyUSD, r.EndpointCostMonthlyUSD, r.NetSavingsMonthlyUSD)
+		}
+	}
+}
+
+func printAnomalies(anomalies []report.Anomaly) {
+	if len(anomalies) == 0 {
+		return
+	}
+
+	fmt.Println("🚨 Egress Anomalies:")
+	for _, a := range anomalies {
+		gb := float64(a.Bytes) / (1024 * 1024 * 1024)
+		switch a.Reason {
+		case report.AnomalyNewHighVolume:
+			fmt.Printf("   %-11s %-39s %10.2f GB   never seen in %d days\n", a.Kind, a.Key, gb, a.HistoryDays)
+		default:
+			baseline := float64(a.BaselineBytes) / (1024 * 1024 * 1024)
+			fmt.Printf("   %-11s %-39s %10.2f GB   baseline %.2f GB (score %.1f)\n", a.Kind, a.Key, gb, baseline, a.Score)
+		}
+	}
 	fmt.Println("=================================================================")
 }
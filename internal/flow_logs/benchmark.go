@@ -0,0 +1,78 @@
+package flow_logs
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+	"vpc_flowlogs_egress_analyzer/internal/cache"
+)
+
+const benchmarkRounds = 3
+
+// BenchmarkCacheFormats compares the size and speed of the cache formats on the configured day,
+// written and loaded with verification through an in-memory cache so storage is left out
+func BenchmarkCacheFormats() error {
+	ctx := context.TODO()
+	store, err := OpenCache()
+	if err != nil {
+		return err
+	}
+	records, _, err := RetrieveVPCFlowLogs(ctx, store)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("no records to benchmark")
+	}
+
+	fmt.Printf("\n⏱️ Cache format benchmark on %d records, best of %d rounds\n", len(records), benchmarkRounds)
+
+	bucket, prefix, region, account, day, month, year, _ := getFlowLogConfig()
+	dataset := Dataset{Bucket: bucket, Prefix: prefix, Account: account, Region: region, FormatVersion: cacheFormatVersion}
+	if m, err := dataset.loadManifest(ctx, store, year+"-"+month+"-"+day); err == nil && m != nil {
+		var source int64
+		for _, obj := range m.Objects {
+			source += obj.Size
+		}
+		fmt.Printf("   %-8s %10.2f MB\n", "S3 logs", float64(source)/1e6)
+	}
+
+	fmt.Printf("   %-8s %10s %12s %12s %14s\n", "Format", "Size", "Encode", "Decode", "Decode rate")
+	for _, format := range []string{CacheFormatJSON, CacheFormatBinary} {
+		codec := cacheCodec(format)
+		mem := cache.NewMemory()
+
+		var info cache.Info
+		var encode, decode time.Duration
+		var decoded []VPCFlowLogRecord
+		for i := 0; i < benchmarkRounds; i++ {
+			start := time.Now()
+			if info, err = cache.Write(ctx, mem, format, codec, records); err != nil {
+				return fmt.Errorf("%s encode: %w", format, err)
+			}
+			encode = best(encode, time.Since(start))
+
+			start = time.Now()
+			if decoded, err = cache.LoadVerified[[]VPCFlowLogRecord](ctx, mem, format, codec, info); err != nil {
+				return fmt.Errorf("%s decode: %w", format, err)
+			}
+			decode = best(decode, time.Since(start))
+		}
+
+		if !reflect.DeepEqual(decoded, records) {
+			return fmt.Errorf("%s: decoded records differ from the original", format)
+		}
+
+		fmt.Printf("   %-8s %7.2f MB %12s %12s %9.0f rec/s\n", format, float64(info.Size)/1e6,
+			encode.Round(time.Millisecond), decode.Round(time.Millisecond), float64(len(records))/decode.Seconds())
+	}
+	return nil
+}
+
+func best(current, d time.Duration) time.Duration {
+	if current == 0 || d < current {
+		return d
+	}
+	return current
+}
@@ -0,0 +1,376 @@
+package flow_logs
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"vpc_flowlogs_egress_analyzer/internal/cache"
+	"vpc_flowlogs_egress_analyzer/internal/config"
+	services "vpc_flowlogs_egress_analyzer/internal/s3"
+)
+
+const manifestSuffix = "-manifest"
+
+// OpenCache builds the cache configured by CACHE_DIR, CACHE_MAX_SIZE and CACHE_S3_*: the
+// local directory, limited in size, in front of the shared bucket
+func OpenCache() (cache.Cache, error) {
+	var store cache.Cache = localCache()
+
+	maxSize, err := ParseSize(config.GetEnv("CACHE_MAX_SIZE"))
+	if err != nil {
+		fmt.Printf("⚠️ Ignoring CACHE_MAX_SIZE: %v\n", err)
+	} else if maxSize > 0 {
+		limited := cache.NewLimited(store, maxSize, cacheGroup)
+		limited.OnEvict = func(group string, size int64, lastUsed time.Time) {
+			fmt.Printf("🗑️ Evicted %s (%s, last used %s)\n", group, formatSize(size), lastUsed.Format("2006-01-02 15:04"))
+		}
+		store = limited
+	}
+
+	shared, err := sharedCache()
+	if err != nil {
+		return nil, err
+	}
+	if shared != nil {
+		store = cache.NewTiered(store, shared)
+	}
+	return store, nil
+}
+
+func localCache() *cache.FS {
+	return cache.NewFS(cache.Dir())
+}
+
+// sharedCache is the CACHE_S3_BUCKET cache, nil when it is not configured
+func sharedCache() (*cache.S3, error) {
+	bucket := config.GetEnv("CACHE_S3_BUCKET")
+	if bucket == "" {
+		return nil, nil
+	}
+
+	region := config.GetEnv("CACHE_S3_REGION")
+	if region == "" {
+		region = config.GetEnv("AWS_REGION")
+	}
+	accessKey := config.GetEnv("CACHE_S3_ACCESS_KEY_ID")
+	secretKey := config.GetEnv("CACHE_S3_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		accessKey = config.GetEnv("AWS_ACCESS_KEY_ID")
+		secretKey = config.GetEnv("AWS_SECRET_ACCESS_KEY")
+	}
+
+	client, err := services.NewClient(region, config.GetEnv("CACHE_S3_ENDPOINT"),
+		config.GetEnv("CACHE_S3_PATH_STYLE") == "true", accessKey, secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("shared cache: %w", err)
+	}
+	return cache.NewS3(client, bucket, config.GetEnv("CACHE_S3_PREFIX")), nil
+}
+
+// cacheGroup maps the files of a cached day to its ID, so a day is evicted as a whole
+func cacheGroup(key string) string {
+	dir, name := path.Split(key)
+	if dir == "" || len(name) < len("2006-01-02") {
+		return key
+	}
+	if _, err := time.Parse("2006-01-02", name[:10]); err != nil {
+		return key
+	}
+	return dir + name[:10]
+}
+
+// CachedDay is a day of flow logs in the cache, identified by "<namespace>/<date>"
+type CachedDay struct {
+	ID       string
+	Manifest Manifest
+	Size     int64
+	LastUsed time.Time
+}
+
+// cachedDays reads every day in the local cache, its size covers all of its files
+func cachedDays(ctx context.Context, store cache.Cache) ([]CachedDay, error) {
+	entries, err := store.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]int64)
+	for _, e := range entries {
+		sizes[cacheGroup(e.Key)] += e.Size
+	}
+
+	var days []CachedDay
+	for _, e := range entries {
+		key, ok := strings.CutSuffix(e.Key, cache.JSON.Ext())
+		if !ok || !strings.HasSuffix(key, manifestSuffix) {
+			continue
+		}
+		id := strings.TrimSuffix(key, manifestSuffix)
+		m, err := cache.Load[Manifest](ctx, store, key, cache.JSON)
+		if err != nil {
+			fmt.Printf("⚠️ Skipping %s: %v\n", key, err)
+			continue
+		}
+		days = append(days, CachedDay{ID: id, Manifest: m, Size: sizes[cacheGroup(e.Key)], LastUsed: e.ModTime})
+	}
+	return days, nil
+}
+
+func cachedDay(ctx context.Context, store cache.Cache, id string) (CachedDay, error) {
+	days, err := cachedDays(ctx, store)
+	if err != nil {
+		return CachedDay{}, err
+	}
+	for _, d := range days {
+		if d.ID == id {
+			return d, nil
+		}
+	}
+	return CachedDay{}, fmt.Errorf("no cached day %s in %s", id, cache.Dir())
+}
+
+func (d CachedDay) remove(ctx context.Context, store cache.Cache) error {
+	return d.Manifest.Dataset.invalidate(ctx, store, d.Manifest.Date, &d.Manifest)
+}
+
+func PrintCacheList() error {
+	ctx := context.TODO()
+	days, err := cachedDays(ctx, localCache())
+	if err != nil {
+		return err
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].ID < days[j].ID })
+
+	fmt.Printf("📦 Cache directory: %s\n", cache.Dir())
+	if shared, err := sharedCache(); err == nil && shared != nil {
+		fmt.Printf("📦 Shared cache: %s\n", shared)
+	}
+	if len(days) == 0 {
+		fmt.Println("   (empty)")
+		return nil
+	}
+
+	var total int64
+	fmt.Printf("\n%-40s %-36s %10s %10s  %-8s %s\n", "ID", "Source", "Records", "Size", "Status", "Last used")
+	for _, d := range days {
+		status := "complete"
+		if !d.Manifest.Complete {
+			status = "partial"
+		}
+		ds := d.Manifest.Dataset
+		source := strings.TrimSuffix("s3://"+ds.Bucket+"/"+ds.Prefix, "/")
+		fmt.Printf("%-40s %-36s %10d %10s  %-8s %s\n", d.ID, source, d.Manifest.Total, formatSize(d.Size), status, d.LastUsed.Format("2006-01-02 15:04"))
+		total += d.Size
+	}
+	fmt.Printf("\n%d days, %s\n", len(days), formatSize(total))
+	return nil
+}
+
+// InspectCachedDay prints a cached day and verifies every chunk
+func InspectCachedDay(id string) error {
+	ctx := context.TODO()
+	store := localCache()
+	d, err := cachedDay(ctx, store, id)
+	if err != nil {
+		return err
+	}
+	m := d.Manifest
+
+	fmt.Printf("📦 %s\n", d.ID)
+	fmt.Printf("   Source:    %s\n", m.Dataset)
+	fmt.Printf("   Date:      %s\n", m.Date)
+	fmt.Printf("   Status:    complete=%t, listed at %s\n", m.Complete, m.ListedAt.Format(time.RFC3339))
+	fmt.Printf("   Objects:   %d\n", len(m.Objects))
+	fmt.Printf("   Records:   %d\n", m.Total)
+	fmt.Printf("   Size:      %s\n", formatSize(d.Size))
+	fmt.Printf("   Last used: %s\n\n", d.LastUsed.Format(time.RFC3339))
+
+	bad := 0
+	for i, c := range m.Chunks {
+		format := c.Format
+		if format == "" {
+			format = CacheFormatJSON
+		}
+		key := m.Dataset.chunkKey(m.Date, i+1)
+		status := "✅"
+		records, err := cache.LoadVerified[[]VPCFlowLogRecord](ctx, store, key, cacheCodec(c.Format), c.Info)
+		if err == nil && len(records) != c.Records {
+			err = fmt.Errorf("%d records, expected %d", len(records), c.Records)
+		}
+		if err != nil {
+			status = "❌ " + err.Error()
+			bad++
+		}
+		fmt.Printf("   part %05d  %-6s %9d records %10s  sha256 %.12s  %s\n", i+1, format, c.Records, formatSize(c.Size), c.SHA256, status)
+	}
+
+	if r := m.Rollup; r != nil {
+		status := "✅"
+		rows, err := cache.LoadVerified[[]RollupRow](ctx, store, m.Dataset.rollupKey(m.Date), cache.JSON, r.Info)
+		if err == nil && len(rows) != r.Rows {
+			err = fmt.Errorf("%d rows, expected %d", len(rows), r.Rows)
+		}
+		if err != nil {
+			status = "❌ " + err.Error()
+			bad++
+		}
+		fmt.Printf("   rollup      %-6s %9d rows    %10s  sha256 %.12s  %s (covers %d chunks)\n", CacheFormatJSON, r.Rows, formatSize(r.Size), r.SHA256, status, r.Chunks)
+	}
+
+	if bad > 0 {
+		return fmt.Errorf("%d cache files failed verification", bad)
+	}
+	return nil
+}
+
+// orphanGrace spares the files of a day being written by a concurrent run, its chunks are
+// stored before the manifest that references them
+const orphanGrace = time.Hour
+
+// removeOrphans deletes the files of cached days that no manifest references: days whose
+// manifest is gone and chunks left by an interrupted run or written in another format.
+// Files outside the days, like the hostname caches, are kept.
+func removeOrphans(ctx context.Context, store cache.Cache) error {
+	entries, err := store.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	days, err := cachedDays(ctx, store)
+	if err != nil {
+		return err
+	}
+
+	referenced := make(map[string]bool)
+	for _, d := range days {
+		ds, date := d.Manifest.Dataset, d.Manifest.Date
+		referenced[ds.manifestKey(date)+cache.JSON.Ext()] = true
+		referenced[ds.rollupKey(date)+cache.JSON.Ext()] = true
+		for i, c := range d.Manifest.Chunks {
+			referenced[ds.chunkKey(date, i+1)+cacheCodec(c.Format).Ext()] = true
+		}
+	}
+
+	removed, size := 0, int64(0)
+	for _, e := range entries {
+		if referenced[e.Key] || cacheGroup(e.Key) == e.Key || time.Since(e.ModTime) < orphanGrace {
+			continue
+		}
+		if err := store.Delete(ctx, e.Key); err != nil {
+			return err
+		}
+		removed++
+		size += e.Size
+	}
+	if removed > 0 {
+		fmt.Printf("🗑️ Removed %d cache files no day references (%s)\n", removed, formatSize(size))
+	}
+	return nil
+}
+
+// PruneCache removes the files no cached day references, the days unused for longer than
+// olderThan, then the least recently used days until the local cache fits in maxSize. Zero
+// disables either limit. The shared cache is left untouched.
+func PruneCache(olderThan time.Duration, maxSize int64) error {
+	ctx := context.TODO()
+	store := localCache()
+	if err := removeOrphans(ctx, store); err != nil {
+		return err
+	}
+	days, err := cachedDays(ctx, store)
+	if err != nil {
+		return err
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].LastUsed.Before(days[j].LastUsed) })
+
+	var total int64
+	for _, d := range days {
+		total += d.Size
+	}
+
+	removed := 0
+	for _, d := range days {
+		tooOld := olderThan > 0 && time.Since(d.LastUsed) > olderThan
+		tooBig := maxSize > 0 && total > maxSize
+		if !tooOld && !tooBig {
+			continue
+		}
+		if err := d.remove(ctx, store); err != nil {
+			return err
+		}
+		fmt.Printf("🗑️ Evicted %s (%s, last used %s)\n", d.ID, formatSize(d.Size), d.LastUsed.Format("2006-01-02 15:04"))
+		total -= d.Size
+		removed++
+	}
+
+	if removed > 0 {
+		fmt.Printf("📦 Cache now holds %s\n", formatSize(total))
+	}
+	return nil
+}
+
+// ClearCache removes the local cache directory, the shared cache is left untouched
+func ClearCache() error {
+	if err := localCache().Clear(); err != nil {
+		return err
+	}
+	fmt.Printf("🗑️ Cleared %s\n", cache.Dir())
+	return nil
+}
+
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+}
+
+// ParseSize reads sizes like 500MB or 20GB (binary units), an empty string is 0
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+	for _, u := range sizeUnits {
+		if num, ok := strings.CutSuffix(s, u.suffix); ok {
+			v, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("invalid size %q", s)
+			}
+			return int64(v * float64(u.bytes)), nil
+		}
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return v, nil
+}
+
+// ParseAge reads durations like 30d, 12h or 90m
+func ParseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
+
+func formatSize(b int64) string {
+	for _, u := range sizeUnits {
+		if b >= u.bytes && u.bytes > 1 {
+			return fmt.Sprintf("%.1f %s", float64(b)/float64(u.bytes), u.suffix)
+		}
+	}
+	return fmt.Sprintf("%d B", b)
+}
@@ -0,0 +1,68 @@
+package flow_logs
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+	"vpc_flowlogs_egress_analyzer/internal/cache"
+)
+
+func TestRemoveOrphans(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := cache.NewFS(dir)
+
+	dc := testDay(t, store, syntheticRecords(100))
+	if err := cache.Save(ctx, store, dc.dataset.manifestKey(dc.date), *dc.manifest); err != nil {
+		t.Fatalf("save manifest: %v", err)
+	}
+	kept := []string{
+		dc.dataset.chunkKey(dc.date, 1) + recordCodec.Ext(),
+		dc.dataset.manifestKey(dc.date) + cache.JSON.Ext(),
+		"hostnames-ptr" + cache.JSON.Ext(),
+	}
+
+	orphans := []string{
+		// The same chunk in the format the manifest does not record
+		dc.dataset.chunkKey(dc.date, 1) + cache.JSON.Ext(),
+		// A chunk past the manifest, left by an interrupted refresh
+		dc.dataset.chunkKey(dc.date, 2) + recordCodec.Ext(),
+		// A day whose manifest is gone
+		dc.dataset.chunkKey("2025-12-01", 1) + recordCodec.Ext(),
+	}
+	recent := dc.dataset.chunkKey("2025-12-03", 1) + recordCodec.Ext()
+	for _, key := range append(append(orphans, recent), kept[2]) {
+		if err := store.Put(ctx, key, bytes.NewReader([]byte("data"))); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+
+	old := time.Now().Add(-2 * orphanGrace)
+	for _, key := range append(append([]string{}, kept...), orphans...) {
+		if err := os.Chtimes(filepath.Join(dir, filepath.FromSlash(key)), old, old); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+
+	if err := removeOrphans(ctx, store); err != nil {
+		t.Fatalf("remove orphans: %v", err)
+	}
+
+	entries, err := store.List(ctx, "")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Key)
+	}
+	// A recent file may belong to a day still being written
+	want := []string{kept[1], kept[0], recent, kept[2]}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("cache holds %v, expected %v", got, want)
+	}
+}
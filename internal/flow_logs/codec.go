@@ -0,0 +1,256 @@
+package flow_logs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"vpc_flowlogs_egress_analyzer/internal/cache"
+	"vpc_flowlogs_egress_analyzer/internal/config"
+)
+
+const (
+	CacheFormatBinary = "binary"
+	CacheFormatJSON   = "json"
+)
+
+// Binary chunk layout, gzip compressed:
+//
+//	"VPCF" version(1)
+//	uvarint string count, then each string as uvarint length + bytes
+//	uvarint record count, then per record:
+//	  varint version, uvarint dictionary index of account, interface, srcaddr, dstaddr,
+//	  action, log-status, pkt-srcaddr, pkt-dstaddr, pkt-src-aws-service,
+//	  pkt-dst-aws-service, direction, varint srcport, dstport, protocol, packets, bytes,
+//	  varint start as a delta from the previous record, varint end as a delta from start
+//
+// Strings are the dictionary: IPs, ENIs and services repeat across records of a chunk.
+var recordCodec cache.Codec = binaryCodec{}
+
+const (
+	binaryMagic   = "VPCF"
+	binaryVersion = 1
+)
+
+// cacheCodec is the codec of a chunk format, an empty format is a chunk written as JSON
+// before the binary format existed
+func cacheCodec(format string) cache.Codec {
+	if format == CacheFormatBinary {
+		return recordCodec
+	}
+	return cache.JSON
+}
+
+// cacheFormat is the format new chunks are written in
+func cacheFormat() string {
+	if config.GetEnv("CACHE_FORMAT") == CacheFormatJSON {
+		return CacheFormatJSON
+	}
+	return CacheFormatBinary
+}
+
+type binaryCodec struct{}
+
+func (binaryCodec) Ext() string {
+	return ".bin.gz"
+}
+
+func (binaryCodec) Encode(w io.Writer, v any) error {
+	var records []VPCFlowLogRecord
+	switch x := v.(type) {
+	case []VPCFlowLogRecord:
+		records = x
+	case *[]VPCFlowLogRecord:
+		records = *x
+	default:
+		return fmt.Errorf("binary codec cannot encode %T", v)
+	}
+
+	dict := make(map[string]uint64)
+	var strs []string
+	intern := func(s string) uint64 {
+		idx, ok := dict[s]
+		if !ok {
+			idx = uint64(len(strs))
+			dict[s] = idx
+			strs = append(strs, s)
+		}
+		return idx
+	}
+
+	body := make([]byte, 0, len(records)*32)
+	var prevStart int64
+	for _, r := range records {
+		body = binary.AppendVarint(body, int64(r.Version))
+		for _, s := range recordStrings(&r) {
+			body = binary.AppendUvarint(body, intern(*s))
+		}
+		for _, f := range [...]int{r.SrcPort, r.DstPort, r.Protocol, r.Packets, r.Bytes} {
+			body = binary.AppendVarint(body, int64(f))
+		}
+		body = binary.AppendVarint(body, r.Start-prevStart)
+		body = binary.AppendVarint(body, r.End-r.Start)
+		prevStart = r.Start
+	}
+
+	gz, err := gzip.NewWriterLevel(w, gzip.BestSpeed)
+	if err != nil {
+		return err
+	}
+
+	head := append([]byte(binaryMagic), binaryVersion)
+	head = binary.AppendUvarint(head, uint64(len(strs)))
+	for _, s := range strs {
+		head = binary.AppendUvarint(head, uint64(len(s)))
+		head = append(head, s...)
+	}
+	head = binary.AppendUvarint(head, uint64(len(records)))
+
+	if _, err := gz.Write(head); err != nil {
+		return fmt.Errorf("binary encode: %w", err)
+	}
+	if _, err := gz.Write(body); err != nil {
+		return fmt.Errorf("binary encode: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("gzip close: %w", err)
+	}
+	return nil
+}
+
+func (binaryCodec) Decode(r io.Reader, v any) error {
+	out, ok := v.(*[]VPCFlowLogRecord)
+	if !ok {
+		return fmt.Errorf("binary codec cannot decode into %T", v)
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("gzip reader: %w", err)
+	}
+	defer gz.Close()
+
+	// Decoded in memory so every count can be checked against the bytes left, a corrupt
+	// count must not allocate more than the chunk could possibly hold
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		return fmt.Errorf("gzip read: %w", err)
+	}
+	if len(data) < len(binaryMagic)+1 {
+		return fmt.Errorf("binary header: %w", io.ErrUnexpectedEOF)
+	}
+	head := data[:len(binaryMagic)+1]
+	if string(head[:len(binaryMagic)]) != binaryMagic || head[len(binaryMagic)] != binaryVersion {
+		return fmt.Errorf("binary header: unsupported %q", head)
+	}
+
+	br := bytes.NewReader(data[len(head):])
+	d := decoder{r: br}
+
+	strs := make([]string, d.count("string", 1))
+	for i := range strs {
+		b := make([]byte, d.count("string byte", 1))
+		if d.err == nil {
+			_, d.err = io.ReadFull(br, b)
+		}
+		strs[i] = string(b)
+	}
+	str := func() string {
+		idx := d.uvarint()
+		if idx >= uint64(len(strs)) {
+			if d.err == nil {
+				d.err = fmt.Errorf("string index %d out of range", idx)
+			}
+			return ""
+		}
+		return strs[idx]
+	}
+
+	n := d.count("record", minRecordSize)
+	if d.err != nil {
+		return fmt.Errorf("binary decode: %w", d.err)
+	}
+
+	records := make([]VPCFlowLogRecord, n)
+	var prevStart int64
+	for i := range records {
+		rec := &records[i]
+		rec.Version = int(d.varint())
+		for _, s := range recordStrings(rec) {
+			*s = str()
+		}
+		for _, f := range [...]*int{&rec.SrcPort, &rec.DstPort, &rec.Protocol, &rec.Packets, &rec.Bytes} {
+			*f = int(d.varint())
+		}
+		rec.Start = prevStart + d.varint()
+		rec.End = rec.Start + d.varint()
+		prevStart = rec.Start
+
+		if d.err != nil {
+			return fmt.Errorf("binary decode record %d: %w", i, d.err)
+		}
+	}
+
+	*out = records
+	return nil
+}
+
+// recordStrings lists the dictionary encoded fields, in file order
+func recordStrings(r *VPCFlowLogRecord) [11]*string {
+	return [...]*string{&r.AccountId, &r.InterfaceID, &r.SrcAddr, &r.DstAddr, &r.Action, &r.LogStatus,
+		&r.PktSrcAddr, &r.PktDstAddr, &r.PktSrcAwsService, &r.PktDstAwsService, &r.Direction}
+}
+
+// minRecordSize is the smallest encoded record, one byte per varint: version, 11 strings,
+// 5 integers, start and end
+const minRecordSize = 1 + 11 + 5 + 2
+
+// decoder keeps the first read error so fields can be read without checking each one
+type decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+// count reads the number of following items, rejecting counts that cannot fit in the
+// bytes left when each item takes at least size bytes
+func (d *decoder) count(what string, size int) int {
+	n := d.uvarint()
+	if d.err == nil && n > uint64(d.r.Len()/size) {
+		d.err = fmt.Errorf("%w: %s count %d exceeds the %d bytes left", io.ErrUnexpectedEOF, what, n, d.r.Len())
+	}
+	if d.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.err = unexpectedEOF(err)
+	}
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	if err != nil {
+		d.err = unexpectedEOF(err)
+	}
+	return v
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,233 @@
+package flow_logs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"vpc_flowlogs_egress_analyzer/internal/cache"
+)
+
+func syntheticRecords(n int) []VPCFlowLogRecord {
+	records := make([]VPCFlowLogRecord, n)
+	start := int64(1764633600)
+	for i := range records {
+		direction := "egress"
+		if i%3 == 0 {
+			direction = "ingress"
+		}
+		service := "-"
+		if i%7 == 0 {
+			service = "S3"
+		}
+		records[i] = VPCFlowLogRecord{
+			Version:          5,
+			AccountId:        "123456789012",
+			InterfaceID:      fmt.Sprintf("eni-%04d", i%13),
+			SrcAddr:          fmt.Sprintf("10.0.%d.%d", i%4, i%250),
+			DstAddr:          fmt.Sprintf("52.%d.%d.%d", i%9, i%31, i%200),
+			SrcPort:          32768 + i%20000,
+			DstPort:          []int{443, 80, 53, 5432}[i%4],
+			Protocol:         []int{6, 17}[i%2],
+			Packets:          1 + i%50,
+			Bytes:            40 + i*37%150000,
+			Start:            start + int64(i/10),
+			End:              start + int64(i/10) + int64(i%60),
+			Action:           "ACCEPT",
+			LogStatus:        "OK",
+			PktSrcAddr:       "-",
+			PktDstAddr:       "-",
+			PktSrcAwsService: "-",
+			PktDstAwsService: service,
+			Direction:        direction,
+		}
+	}
+	return records
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	records := syntheticRecords(5000)
+
+	for _, format := range []string{CacheFormatJSON, CacheFormatBinary} {
+		t.Run(format, func(t *testing.T) {
+			codec := cacheCodec(format)
+
+			var buf bytes.Buffer
+			if err := codec.Encode(&buf, records); err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			var decoded []VPCFlowLogRecord
+			if err := codec.Decode(&buf, &decoded); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, records) {
+				t.Fatalf("decoded records differ from the original")
+			}
+		})
+	}
+}
+
+func TestBinaryCodecEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := recordCodec.Encode(&buf, []VPCFlowLogRecord{}); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	var decoded []VPCFlowLogRecord
+	if err := recordCodec.Decode(&buf, &decoded); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(decoded) != 0 {
+		t.Fatalf("decoded %d records, expected none", len(decoded))
+	}
+}
+
+// gzipped compresses raw so corrupt content reaches the binary decoder past gzip
+func gzipped(t *testing.T, raw []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(raw)
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestBinaryCodecCorruptInput(t *testing.T) {
+	var valid bytes.Buffer
+	if err := recordCodec.Encode(&valid, syntheticRecords(100)); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	raw := valid.Bytes()
+
+	header := append([]byte(binaryMagic), binaryVersion)
+	hugeCount := binary.AppendUvarint(append([]byte{}, header...), 1<<62)
+	hugeString := binary.AppendUvarint(binary.AppendUvarint(append([]byte{}, header...), 1), 1<<40)
+	hugeRecords := binary.AppendUvarint(binary.AppendUvarint(append([]byte{}, header...), 0), 1<<50)
+
+	cases := map[string][]byte{
+		"empty":              nil,
+		"not gzip":           []byte("not a cache chunk"),
+		"truncated gzip":     raw[:len(raw)/2],
+		"bad magic":          gzipped(t, []byte("JSON\x01")),
+		"truncated header":   gzipped(t, header[:2]),
+		"huge string count":  gzipped(t, hugeCount),
+		"huge string length": gzipped(t, hugeString),
+		"huge record count":  gzipped(t, hugeRecords),
+		"truncated records":  gzipped(t, append(binary.AppendUvarint(binary.AppendUvarint(append([]byte{}, header...), 0), 2), 0, 0)),
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			var decoded []VPCFlowLogRecord
+			if err := recordCodec.Decode(bytes.NewReader(data), &decoded); err == nil {
+				t.Fatalf("decoded %d records from corrupt input without error", len(decoded))
+			}
+		})
+	}
+}
+
+func TestLoadVerifiedRejectsBitFlip(t *testing.T) {
+	ctx := context.Background()
+	store := cache.NewMemory()
+
+	info, err := cache.Write(ctx, store, "chunk", recordCodec, syntheticRecords(100))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := cache.LoadVerified[[]VPCFlowLogRecord](ctx, store, "chunk", recordCodec, info); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	r, _ := store.Get(ctx, "chunk"+recordCodec.Ext())
+	var data bytes.Buffer
+	data.ReadFrom(r)
+	flipped := data.Bytes()
+	flipped[len(flipped)/2] ^= 0x40
+	store.Put(ctx, "chunk"+recordCodec.Ext(), bytes.NewReader(flipped))
+
+	_, err = cache.LoadVerified[[]VPCFlowLogRecord](ctx, store, "chunk", recordCodec, info)
+	if !errors.Is(err, cache.ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+}
+
+func benchmarkCodecs(b *testing.B, run func(b *testing.B, codec cache.Codec, records []VPCFlowLogRecord)) {
+	records := syntheticRecords(100000)
+	for _, format := range []string{CacheFormatJSON, CacheFormatBinary} {
+		b.Run(format, func(b *testing.B) {
+			run(b, cacheCodec(format), records)
+		})
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	benchmarkCodecs(b, func(b *testing.B, codec cache.Codec, records []VPCFlowLogRecord) {
+		var buf bytes.Buffer
+		for i := 0; i < b.N; i++ {
+			buf.Reset()
+			if err := codec.Encode(&buf, records); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(buf.Len()), "bytes/chunk")
+	})
+}
+
+func BenchmarkDecode(b *testing.B) {
+	benchmarkCodecs(b, func(b *testing.B, codec cache.Codec, records []VPCFlowLogRecord) {
+		var buf bytes.Buffer
+		if err := codec.Encode(&buf, records); err != nil {
+			b.Fatal(err)
+		}
+		data := buf.Bytes()
+		b.SetBytes(int64(len(data)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			var decoded []VPCFlowLogRecord
+			if err := codec.Decode(bytes.NewReader(data), &decoded); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestLegacyJSONChunks(t *testing.T) {
+	ctx := context.Background()
+	store := cache.NewMemory()
+	dataset := Dataset{Bucket: "logs", Account: "123456789012", Region: "eu-west-3", FormatVersion: cacheFormatVersion}
+	date := "2025-12-02"
+	records := syntheticRecords(50)
+
+	// Chunks written before the binary format existed are JSON and record no format
+	info, err := cache.Write(ctx, store, dataset.chunkKey(date, 1), cache.JSON, records)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	m := Manifest{Dataset: dataset, Date: date, Complete: true, Total: int64(len(records)), Chunks: []ChunkInfo{{Records: len(records), Info: info}}}
+	if err := cache.Save(ctx, store, dataset.manifestKey(date), m); err != nil {
+		t.Fatalf("save manifest: %v", err)
+	}
+
+	loaded, err := dataset.loadManifest(ctx, store, date)
+	if err != nil || loaded == nil {
+		t.Fatalf("load manifest: %v", err)
+	}
+	got, err := loadChunks(ctx, store, dataset, date, loaded.Chunks)
+	if err != nil {
+		t.Fatalf("load chunks: %v", err)
+	}
+	if !reflect.DeepEqual(got, records) {
+		t.Fatalf("legacy chunk records differ from the original")
+	}
+
+	if err := dataset.invalidate(ctx, store, date, loaded); err != nil {
+		t.Fatalf("invalidate: %v", err)
+	}
+	if entries, _ := store.List(ctx, ""); len(entries) != 0 {
+		t.Fatalf("invalidate left %v behind", entries)
+	}
+}
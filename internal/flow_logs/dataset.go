@@ -0,0 +1,154 @@
+package flow_logs
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"vpc_flowlogs_egress_analyzer/internal/cache"
+)
+
+// cacheFormatVersion changes whenever cached chunks can no longer be read by older versions
+const cacheFormatVersion = 2
+
+// Dataset identifies the flow logs a cache entry was built from
+type Dataset struct {
+	Bucket        string `json:"bucket"`
+	Prefix        string `json:"prefix"`
+	Account       string `json:"account"`
+	Region        string `json:"region"`
+	FormatVersion int    `json:"format_version"`
+}
+
+// logDeliveryDelay is how long after midnight UTC a day's listing is trusted to be final
+const logDeliveryDelay = time.Hour
+
+// Manifest describes one cached day, it is written last so a day without manifest is incomplete.
+// Objects lists the S3 objects already ingested, a day listed before it was over stays
+// incomplete and is refreshed with new objects on the next run.
+type Manifest struct {
+	Dataset  Dataset               `json:"dataset"`
+	Date     string                `json:"date"`
+	Total    int64                 `json:"total"`
+	Chunks   []ChunkInfo           `json:"chunks"`
+	Objects  map[string]ObjectInfo `json:"objects"`
+	ListedAt time.Time             `json:"listed_at"`
+	Complete bool                  `json:"complete"`
+	Rollup   *RollupInfo           `json:"rollup,omitempty"`
+}
+
+// ChunkInfo lets a chunk be verified on load, chunk N is Chunks[N-1]. Format is empty for
+// chunks written before the binary format existed.
+type ChunkInfo struct {
+	Format  string `json:"format,omitempty"`
+	Records int    `json:"records"`
+	cache.Info
+}
+
+type ObjectInfo struct {
+	ETag string `json:"etag"`
+	Size int64  `json:"size"`
+}
+
+// Namespace is the cache directory of the dataset, readable but unique per source identity
+func (d Dataset) Namespace() string {
+	id := strings.Join([]string{d.Bucket, d.Prefix, d.Account, d.Region, strconv.Itoa(d.FormatVersion)}, "\x00")
+	sum := sha256.Sum256([]byte(id))
+	return fmt.Sprintf("%s-%s-%x", d.Account, d.Region, sum[:6])
+}
+
+func (d Dataset) String() string {
+	return fmt.Sprintf("s3://%s/%s (account %s, region %s, format v%d)", d.Bucket, d.Prefix, d.Account, d.Region, d.FormatVersion)
+}
+
+func (d Dataset) manifestKey(date string) string {
+	return d.dayID(date) + manifestSuffix
+}
+
+func (d Dataset) dayID(date string) string {
+	return d.Namespace() + "/" + date
+}
+
+func (d Dataset) rollupKey(date string) string {
+	return d.dayID(date) + "-rollup"
+}
+
+func (d Dataset) chunkKey(date string, idx int) string {
+	return fmt.Sprintf("%s/%s-part-%05d", d.Namespace(), date, idx)
+}
+
+// changedObjects returns the ingested objects that were modified or removed since, their
+// records cannot be told apart in the chunks so the whole day has to be downloaded again.
+// Manifests from before objects were recorded are reported as changed.
+func (m *Manifest) changedObjects(listed map[string]ObjectInfo) []string {
+	if m.Objects == nil {
+		return []string{"(no object list)"}
+	}
+	var changed []string
+	for key, obj := range m.Objects {
+		if now, ok := listed[key]; !ok || now != obj {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// dayComplete reports whether a listing made at listedAt can no longer miss objects of date
+func dayComplete(date string, listedAt time.Time) bool {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return false
+	}
+	return listedAt.After(day.AddDate(0, 0, 1).Add(logDeliveryDelay))
+}
+
+// loadManifest returns nil when the day is not cached or its manifest is unreadable, and an
+// error when the cached day belongs to another source
+func (d Dataset) loadManifest(ctx context.Context, store cache.Cache, date string) (*Manifest, error) {
+	key := d.manifestKey(date)
+	exists, err := cache.Exists(ctx, store, key, cache.JSON)
+	if err != nil {
+		return nil, fmt.Errorf("check cache manifest: %w", err)
+	}
+	if !exists {
+		if legacy, _ := cache.Exists(ctx, store, date+"-meta", cache.JSON); legacy {
+			fmt.Printf("⚠️ Ignoring legacy cache entry %s-meta, it does not record its source\n", date)
+		}
+		return nil, nil
+	}
+
+	m, err := cache.Load[Manifest](ctx, store, key, cache.JSON)
+	if errors.Is(err, cache.ErrCorrupt) {
+		fmt.Printf("⚠️ Ignoring unreadable cache manifest %s: %v\n", key, err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load cache manifest: %w", err)
+	}
+	if m.Dataset != d || m.Date != date {
+		return nil, fmt.Errorf("cache manifest %s was built from %s for %s, expected %s for %s: remove it to re-download",
+			key, m.Dataset, m.Date, d, date)
+	}
+	return &m, nil
+}
+
+// invalidate removes a cached day from store, manifest first so a partial removal is never loaded
+func (d Dataset) invalidate(ctx context.Context, store cache.Cache, date string, m *Manifest) error {
+	if err := cache.Remove(ctx, store, d.manifestKey(date), cache.JSON); err != nil {
+		return err
+	}
+	if err := cache.Remove(ctx, store, d.rollupKey(date), cache.JSON); err != nil {
+		return err
+	}
+	for i, c := range m.Chunks {
+		if err := cache.Remove(ctx, store, d.chunkKey(date, i+1), cacheCodec(c.Format)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+package flow_logs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"vpc_flowlogs_egress_analyzer/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	downloadBaseBackoff = 500 * time.Millisecond
+	downloadMaxBackoff  = 30 * time.Second
+	throttledBackoff    = 2 * time.Second
+)
+
+// downloader fetches S3 objects for the download workers, which share its concurrency
+// limit, bandwidth cap and statistics
+type downloader struct {
+	client     *s3.Client
+	bucket     string
+	maxRetries int
+	throttle   *throttle
+	bandwidth  *bandwidthLimiter
+	stats      *downloadStats
+}
+
+func newDownloader(client *s3.Client, bucket string, concurrency int) (*downloader, error) {
+	d := &downloader{
+		client:     client,
+		bucket:     bucket,
+		maxRetries: config.GetEnvInt("DOWNLOAD_MAX_RETRIES"),
+		throttle:   newThrottle(concurrency),
+		stats:      &downloadStats{start: time.Now()},
+	}
+
+	limit, err := ParseSize(config.GetEnv("DOWNLOAD_BANDWIDTH"))
+	if err != nil {
+		return nil, fmt.Errorf("DOWNLOAD_BANDWIDTH: %w", err)
+	}
+	if limit > 0 {
+		fmt.Printf("⚙️ Limiting S3 downloads to %s/s\n", formatSize(limit))
+		d.bandwidth = &bandwidthLimiter{rate: float64(limit)}
+	}
+	return d, nil
+}
+
+// fetch reads a whole S3 object, retrying failed requests and truncated streams with
+// exponential backoff and full jitter. A retry after a partial read resumes with a range
+// request pinned to the listed ETag, so an object replaced meanwhile fails instead of mixing
+// two versions. Retries are made here rather than by the SDK so throttling is seen.
+func (d *downloader) fetch(ctx context.Context, key string, obj ObjectInfo) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(int(obj.Size))
+
+	var lastErr error
+	for attempt := 0; attempt <= d.maxRetries; attempt++ {
+		if attempt > 0 {
+			wait := downloadBackoff(attempt)
+			if isThrottled(lastErr) {
+				wait += throttledBackoff
+			}
+			d.stats.addRetry()
+			fmt.Printf("⏳ %s attempt %d failed after %d bytes (%v), retrying in %s\n", key, attempt, buf.Len(), lastErr, wait.Round(time.Millisecond))
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		err := d.get(ctx, key, obj, &buf)
+		if err == nil {
+			d.stats.addObject()
+			return buf.Bytes(), nil
+		}
+
+		lastErr = err
+		if !retryableDownload(err) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("failed after %d attempts: %w", d.maxRetries+1, lastErr)
+}
+
+// get makes one request for the rest of the object, appending it to buf
+func (d *downloader) get(ctx context.Context, key string, obj ObjectInfo, buf *bytes.Buffer) error {
+	if err := d.throttle.acquire(ctx); err != nil {
+		return err
+	}
+
+	input := &s3.GetObjectInput{Bucket: aws.String(d.bucket), Key: aws.String(key)}
+	if buf.Len() > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", buf.Len()))
+		if obj.ETag != "" {
+			input.IfMatch = aws.String(obj.ETag)
+		}
+	}
+
+	out, err := d.client.GetObject(ctx, input, func(o *s3.Options) {
+		o.RetryMaxAttempts = 1
+	})
+	if err == nil {
+		_, err = io.Copy(buf, &meteredReader{ctx: ctx, r: out.Body, d: d})
+		out.Body.Close()
+	}
+	if err == nil && obj.Size > 0 && int64(buf.Len()) != obj.Size {
+		err = fmt.Errorf("%w: read %d of %d bytes", io.ErrUnexpectedEOF, buf.Len(), obj.Size)
+	}
+
+	throttled := isThrottled(err)
+	if throttled {
+		d.stats.addThrottled()
+	}
+	d.throttle.release(throttled)
+	return err
+}
+
+// retryableDownload reports whether a download error may be transient: network errors,
+// truncated streams, throttling and server errors. Missing objects, denied access and
+// objects changed since they were listed are not retried.
+func retryableDownload(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var resp *awshttp.ResponseError
+	if errors.As(err, &resp) {
+		status := resp.HTTPStatusCode()
+		return status == http.StatusTooManyRequests || status >= 500
+	}
+	return true
+}
+
+// isThrottled matches S3 asking clients to slow down, 503 SlowDown or 429
+func isThrottled(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "SlowDown" {
+		return true
+	}
+	var resp *awshttp.ResponseError
+	return errors.As(err, &resp) && (resp.HTTPStatusCode() == http.StatusServiceUnavailable || resp.HTTPStatusCode() == http.StatusTooManyRequests)
+}
+
+func downloadBackoff(attempt int) time.Duration {
+	d := downloadBaseBackoff << (attempt - 1)
+	if d > downloadMaxBackoff || d <= 0 {
+		d = downloadMaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+// throttle bounds the requests in flight and adapts the bound to S3 throttling: a throttled
+// request halves it, at most once per throttleCooldown as requests in flight are throttled
+// together, and each run of successful requests as long as the bound raises it by one, up to
+// the configured concurrency
+type throttle struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	limit   int
+	max     int
+	lowest  int
+	active  int
+	streak  int
+	lastCut time.Time
+}
+
+const throttleCooldown = time.Second
+
+func newThrottle(concurrency int) *throttle {
+	t := &throttle{limit: concurrency, max: concurrency, lowest: concurrency}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// acquire waits for a request slot. Cancelling ctx wakes the waiters so they give up instead
+// of waiting for another request to finish.
+func (t *throttle) acquire(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.cond.Broadcast()
+	})
+	defer stop()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.active >= t.limit {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		t.cond.Wait()
+	}
+	t.active++
+	return nil
+}
+
+func (t *throttle) release(throttled bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.active--
+	switch {
+	case throttled:
+		t.streak = 0
+		if t.limit > 1 && time.Since(t.lastCut) > throttleCooldown {
+			t.lastCut = time.Now()
+			t.limit /= 2
+			t.lowest = min(t.lowest, t.limit)
+			fmt.Printf("🐢 S3 is throttling, lowering download concurrency to %d\n", t.limit)
+		}
+	case t.limit < t.max:
+		t.streak++
+		if t.streak >= t.limit {
+			t.streak = 0
+			t.limit++
+		}
+	}
+	t.cond.Broadcast()
+}
+
+// bandwidthLimiter paces the reads of every worker to rate bytes per second
+type bandwidthLimiter struct {
+	mu   sync.Mutex
+	rate float64
+	next time.Time
+}
+
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// meteredReader counts downloaded bytes and applies the bandwidth cap
+type meteredReader struct {
+	ctx context.Context
+	r   io.Reader
+	d   *downloader
+}
+
+func (m *meteredReader) Read(p []byte) (int, error) {
+	if len(p) > 32*1024 {
+		p = p[:32*1024]
+	}
+	n, err := m.r.Read(p)
+	m.d.stats.addBytes(n)
+	if m.d.bandwidth != nil && n > 0 {
+		if waitErr := m.d.bandwidth.wait(m.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// downloadStats is the throughput of a download, parse and write times are summed over workers
+type downloadStats struct {
+	start     time.Time
+	bytes     atomic.Int64
+	objects   atomic.Int64
+	records   atomic.Int64
+	retries   atomic.Int64
+	throttled atomic.Int64
+	parse     atomic.Int64
+	write     atomic.Int64
+}
+
+func (s *downloadStats) addBytes(n int)           { s.bytes.Add(int64(n)) }
+func (s *downloadStats) addObject()               { s.objects.Add(1) }
+func (s *downloadStats) addRetry()                { s.retries.Add(1) }
+func (s *downloadStats) addThrottled()            { s.throttled.Add(1) }
+func (s *downloadStats) addWrite(d time.Duration) { s.write.Add(int64(d)) }
+
+func (s *downloadStats) addParse(records int, d time.Duration) {
+	s.records.Add(int64(records))
+	s.parse.Add(int64(d))
+}
+
+func (d *downloader) printStats(ingested int) {
+	s := d.stats
+	elapsed := time.Since(s.start)
+	bytes := s.bytes.Load()
+	records := s.records.Load()
+
+	fmt.Printf("📈 Downloaded %d objects, %s in %s (%s/s)\n", s.objects.Load(), formatSize(bytes),
+		elapsed.Round(time.Millisecond), formatSize(int64(float64(bytes)/elapsed.Seconds())))
+	fmt.Printf("📈 Ingested %d objects, %d records (%.0f rec/s), parsing %s and writing %s of worker time\n",
+		ingested, records, float64(records)/elapsed.Seconds(),
+		time.Duration(s.parse.Load()).Round(time.Millisecond), time.Duration(s.write.Load()).Round(time.Millisecond))
+	if retries, throttled := s.retries.Load(), s.throttled.Load(); retries > 0 || throttled > 0 {
+		fmt.Printf("📈 %d retries, %d throttled requests, download concurrency went down to %d of %d\n",
+			retries, throttled, d.throttle.lowest, d.throttle.max)
+	}
+}
+
+// parseObject parses a gzip flow log file. Unparsable lines are skipped, but a corrupt or
+// truncated archive fails the whole object so none of its records are kept.
+func parseObject(data []byte) ([]VPCFlowLogRecord, error) {
+	gzr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+	defer gzr.Close()
+
+	var records []VPCFlowLogRecord
+	r := bufio.NewReaderSize(gzr, 256*1024)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 && !strings.HasPrefix(string(line), "version") {
+			if rec, parseErr := ParseFlowLogLine(string(line)); parseErr == nil {
+				rec.Direction = FlowDirection(*rec)
+				records = append(records, *rec)
+			}
+		}
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+	}
+}
+
+// printCompleteness reports how many listed objects of the day are in the cache
+func printCompleteness(listed, ingested int, failed map[string]error) {
+	if len(failed) == 0 {
+		fmt.Printf("📋 Completeness: %d/%d objects ingested\n", ingested, listed)
+		return
+	}
+
+	fmt.Printf("📋 Completeness: %d/%d objects ingested, %d failed and will be retried on the next run:\n", ingested, listed, len(failed))
+	keys := make([]string, 0, len(failed))
+	for key := range failed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("   ❌ %s: %v\n", key, failed[key])
+	}
+}
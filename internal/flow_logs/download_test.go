@@ -0,0 +1,373 @@
+package flow_logs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3Response scripts one answer of scriptedS3: an S3 error status, or the object cut short
+// after half of what was asked, optionally replaced by a new version right after
+type s3Response struct {
+	status   int
+	truncate bool
+	replace  bool
+}
+
+var s3ErrorCodes = map[int]string{
+	http.StatusNotFound:            "NoSuchKey",
+	http.StatusPreconditionFailed:  "PreconditionFailed",
+	http.StatusInternalServerError: "InternalError",
+	http.StatusServiceUnavailable:  "SlowDown",
+}
+
+// scriptedS3 serves a single object with the scripted responses in order, then normally. It
+// honours Range and If-Match and records the headers of each GET.
+type scriptedS3 struct {
+	mu        sync.Mutex
+	data      []byte
+	etag      string
+	responses []s3Response
+	ranges    []string
+	ifMatches []string
+}
+
+func (f *scriptedS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.ranges = append(f.ranges, r.Header.Get("Range"))
+	f.ifMatches = append(f.ifMatches, r.Header.Get("If-Match"))
+
+	var resp s3Response
+	if len(f.responses) > 0 {
+		resp = f.responses[0]
+		f.responses = f.responses[1:]
+	}
+	if ifMatch := r.Header.Get("If-Match"); resp.status == 0 && ifMatch != "" && ifMatch != f.etag {
+		resp.status = http.StatusPreconditionFailed
+	}
+	if resp.status != 0 {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(resp.status)
+		fmt.Fprintf(w, "<Error><Code>%s</Code><Message>scripted</Message></Error>", s3ErrorCodes[resp.status])
+		return
+	}
+
+	offset := 0
+	if rng := r.Header.Get("Range"); rng != "" {
+		offset, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(f.data)-1, len(f.data)))
+	}
+	body := f.data[offset:]
+	w.Header().Set("ETag", f.etag)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if offset > 0 {
+		w.WriteHeader(http.StatusPartialContent)
+	}
+
+	if !resp.truncate {
+		w.Write(body)
+		return
+	}
+	w.Write(body[:len(body)/2])
+	w.(http.Flusher).Flush()
+	if resp.replace {
+		f.data = bytes.Repeat([]byte("y"), len(f.data))
+		f.etag = `"replaced"`
+	}
+	// Drop the connection before the announced length
+	panic(http.ErrAbortHandler)
+}
+
+func newScriptedDownloader(t *testing.T, fake *scriptedS3) *downloader {
+	t.Helper()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(srv.URL),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+	})
+	return &downloader{
+		client:     client,
+		bucket:     "logs",
+		maxRetries: 3,
+		throttle:   newThrottle(2),
+		stats:      &downloadStats{start: time.Now()},
+	}
+}
+
+func TestFetch(t *testing.T) {
+	object := bytes.Repeat([]byte("0123456789"), 10000)
+	const etag = `"v1"`
+
+	cases := []struct {
+		name      string
+		responses []s3Response
+		wantErr   bool
+		status    int // of the returned error
+		ranges    []string
+		ifMatches []string
+		retryable bool
+		throttles int64
+		retries   int64
+	}{
+		{
+			name:      "whole object",
+			ranges:    []string{""},
+			ifMatches: []string{""},
+		},
+		{
+			name:      "truncated body resumes from the bytes read",
+			responses: []s3Response{{truncate: true}},
+			ranges:    []string{"", "bytes=50000-"},
+			ifMatches: []string{"", etag},
+			retries:   1,
+		},
+		{
+			name:      "truncated twice",
+			responses: []s3Response{{truncate: true}, {truncate: true}},
+			ranges:    []string{"", "bytes=50000-", "bytes=75000-"},
+			ifMatches: []string{"", etag, etag},
+			retries:   2,
+		},
+		{
+			name:      "object replaced while resuming is not retried",
+			responses: []s3Response{{truncate: true, replace: true}},
+			wantErr:   true,
+			status:    http.StatusPreconditionFailed,
+			ranges:    []string{"", "bytes=50000-"},
+			ifMatches: []string{"", etag},
+			retries:   1,
+		},
+		{
+			name:      "slow down is retried as throttling",
+			responses: []s3Response{{status: http.StatusServiceUnavailable}},
+			ranges:    []string{"", ""},
+			ifMatches: []string{"", ""},
+			throttles: 1,
+			retries:   1,
+		},
+		{
+			name:      "server errors are retried",
+			responses: []s3Response{{status: http.StatusInternalServerError}},
+			ranges:    []string{"", ""},
+			ifMatches: []string{"", ""},
+			retries:   1,
+		},
+		{
+			name:      "missing object fails fast",
+			responses: []s3Response{{status: http.StatusNotFound}},
+			wantErr:   true,
+			status:    http.StatusNotFound,
+			ranges:    []string{""},
+			ifMatches: []string{""},
+		},
+		{
+			name: "gives up after the retries",
+			responses: []s3Response{
+				{status: http.StatusInternalServerError}, {status: http.StatusInternalServerError},
+				{status: http.StatusInternalServerError}, {status: http.StatusInternalServerError},
+			},
+			wantErr:   true,
+			status:    http.StatusInternalServerError,
+			ranges:    []string{"", "", "", ""},
+			ifMatches: []string{"", "", "", ""},
+			retryable: true,
+			retries:   3,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fake := &scriptedS3{data: object, etag: etag, responses: c.responses}
+			d := newScriptedDownloader(t, fake)
+
+			data, err := d.fetch(context.Background(), "AWSLogs/flow.log.gz", ObjectInfo{ETag: etag, Size: int64(len(object))})
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("fetch succeeded, expected an error")
+				}
+				var resp interface{ HTTPStatusCode() int }
+				if !errors.As(err, &resp) || resp.HTTPStatusCode() != c.status {
+					t.Fatalf("expected a %d error, got %v", c.status, err)
+				}
+				if retryableDownload(err) != c.retryable {
+					t.Fatalf("retryable is %t for %v", !c.retryable, err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("fetch: %v", err)
+				}
+				if !bytes.Equal(data, object) {
+					t.Fatalf("fetched %d bytes differing from the %d bytes object", len(data), len(object))
+				}
+			}
+
+			if strings.Join(fake.ranges, ",") != strings.Join(c.ranges, ",") {
+				t.Fatalf("requested ranges %q, expected %q", fake.ranges, c.ranges)
+			}
+			if strings.Join(fake.ifMatches, ",") != strings.Join(c.ifMatches, ",") {
+				t.Fatalf("If-Match headers %q, expected %q", fake.ifMatches, c.ifMatches)
+			}
+			if got := d.stats.retries.Load(); got != c.retries {
+				t.Fatalf("%d retries, expected %d", got, c.retries)
+			}
+			if got := d.stats.throttled.Load(); got != c.throttles {
+				t.Fatalf("%d throttled requests, expected %d", got, c.throttles)
+			}
+			if d.throttle.active != 0 {
+				t.Fatalf("%d requests still hold a slot", d.throttle.active)
+			}
+		})
+	}
+}
+
+func TestDownloadErrorClassification(t *testing.T) {
+	for _, c := range []struct {
+		status    int
+		retryable bool
+		throttled bool
+	}{
+		{http.StatusServiceUnavailable, true, true},
+		{http.StatusInternalServerError, true, false},
+		{http.StatusNotFound, false, false},
+		{http.StatusPreconditionFailed, false, false},
+	} {
+		fake := &scriptedS3{data: []byte("x"), etag: `"v1"`, responses: []s3Response{{status: c.status}}}
+		d := newScriptedDownloader(t, fake)
+
+		var buf bytes.Buffer
+		err := d.get(context.Background(), "key", ObjectInfo{Size: 1}, &buf)
+		if err == nil {
+			t.Fatalf("%d: get succeeded", c.status)
+		}
+		if got := retryableDownload(err); got != c.retryable {
+			t.Errorf("%d: retryable %t, expected %t (%v)", c.status, got, c.retryable, err)
+		}
+		if got := isThrottled(err); got != c.throttled {
+			t.Errorf("%d: throttled %t, expected %t (%v)", c.status, got, c.throttled, err)
+		}
+	}
+
+	if !retryableDownload(io.ErrUnexpectedEOF) || isThrottled(io.ErrUnexpectedEOF) {
+		t.Errorf("a truncated stream must be retried without counting as throttling")
+	}
+	if retryableDownload(context.Canceled) {
+		t.Errorf("a cancelled download must not be retried")
+	}
+}
+
+func TestThrottleAcquireCancelled(t *testing.T) {
+	th := newThrottle(1)
+	if err := th.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- th.acquire(ctx) }()
+
+	// Let the waiter block before cancelling it, no request ever releases the slot
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("cancelling did not wake the waiting acquire")
+	}
+	if th.active != 1 {
+		t.Fatalf("%d requests in flight, the cancelled acquire must not take a slot", th.active)
+	}
+}
+
+func TestThrottleRelease(t *testing.T) {
+	th := newThrottle(8)
+	request := func(throttled bool) {
+		t.Helper()
+		if err := th.acquire(context.Background()); err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		th.release(throttled)
+	}
+
+	request(true)
+	if th.limit != 4 || th.lowest != 4 {
+		t.Fatalf("limit %d, lowest %d after throttling, expected 4", th.limit, th.lowest)
+	}
+
+	// Requests in flight are throttled together, only the first one cuts within the cooldown
+	request(true)
+	if th.limit != 4 {
+		t.Fatalf("limit %d after a second throttled request within the cooldown, expected 4", th.limit)
+	}
+
+	th.lastCut = time.Time{}
+	request(true)
+	if th.limit != 2 || th.lowest != 2 {
+		t.Fatalf("limit %d, lowest %d after the cooldown, expected 2", th.limit, th.lowest)
+	}
+
+	// A run of successes as long as the limit raises it by one
+	request(false)
+	if th.limit != 2 {
+		t.Fatalf("limit %d after one success, expected 2", th.limit)
+	}
+	request(false)
+	if th.limit != 3 {
+		t.Fatalf("limit %d after two successes, expected 3", th.limit)
+	}
+
+	// A throttled request resets the run
+	request(false)
+	request(false)
+	th.lastCut = time.Now()
+	request(true)
+	request(false)
+	request(false)
+	if th.limit != 3 {
+		t.Fatalf("limit %d, a throttled request must reset the run of successes", th.limit)
+	}
+	request(false)
+	if th.limit != 4 {
+		t.Fatalf("limit %d after a full run, expected 4", th.limit)
+	}
+
+	// Up to the configured concurrency, never above
+	for i := 0; i < 100; i++ {
+		request(false)
+	}
+	if th.limit != 8 || th.lowest != 2 || th.active != 0 {
+		t.Fatalf("limit %d, lowest %d, active %d, expected 8, 2 and 0", th.limit, th.lowest, th.active)
+	}
+
+	// Never below one request
+	one := newThrottle(1)
+	if err := one.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	one.release(true)
+	if one.limit != 1 {
+		t.Fatalf("limit %d, expected 1", one.limit)
+	}
+}
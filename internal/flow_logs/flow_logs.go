@@ -1,24 +1,80 @@
 package flow_logs
 
 import (
-	"bufio"
-	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"path"
 	"runtime"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 	"vpc_flowlogs_egress_analyzer/internal/cache"
+	"vpc_flowlogs_egress_analyzer/internal/config"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	services "vpc_flowlogs_egress_analyzer/internal/s3"
 )
 
-func RetrieveVPCFlowLogs() ([]VPCFlowLogRecord, error) {
-	ctx := context.TODO()
+// dayCache is the cached state of the configured day, in sync with S3
+type dayCache struct {
+	store    cache.Cache
+	dataset  Dataset
+	date     string
+	manifest *Manifest
+	updated  bool
+}
+
+// RetrieveVPCFlowLogs returns every record of the configured day, and whether the day is
+// complete: over, and with every object ingested
+func RetrieveVPCFlowLogs(ctx context.Context, store cache.Cache) ([]VPCFlowLogRecord, bool, error) {
+	return retrieveDay(ctx, store, (*dayCache).records)
+}
+
+// RetrieveEgressRollup returns the egress traffic of the configured day rolled up per hour,
+// and whether the day is complete
+func RetrieveEgressRollup(ctx context.Context, store cache.Cache) ([]RollupRow, bool, error) {
+	return retrieveDay(ctx, store, (*dayCache).rollup)
+}
+
+// retrieveDay brings the cached day up to date and loads it, then publishes it to the shared
+// cache. A corrupt cache is invalidated and downloaded again from S3, bypassing the shared
+// cache which may hold the corrupt copy: publishing the fresh day replaces it.
+func retrieveDay[T any](ctx context.Context, store cache.Cache, load func(*dayCache, context.Context) (T, error)) (T, bool, error) {
+	var zero T
+
+	dc, err := syncDay(ctx, store)
+	if err != nil {
+		return zero, false, err
+	}
+
+	result, err := load(dc, ctx)
+	if errors.Is(err, cache.ErrCorrupt) {
+		fmt.Printf("⚠️ Invalidating cached %s: %v\n", dc.date, err)
+		local := localTier(store)
+		if err := dc.dataset.invalidate(ctx, local, dc.date, dc.manifest); err != nil {
+			return zero, false, err
+		}
+
+		if dc, err = syncDay(ctx, local); err != nil {
+			return zero, false, err
+		}
+		result, err = load(dc, ctx)
+	}
+	if err != nil {
+		return zero, false, err
+	}
+
+	if shared, ok := store.(*cache.Tiered); ok {
+		dc.publish(ctx, shared)
+	}
+	return result, dc.manifest.Complete, nil
+}
 
+// syncDay uses the cached day as is when it is complete, otherwise lists S3 and downloads
+// the objects not cached yet
+func syncDay(ctx context.Context, store cache.Cache) (*dayCache, error) {
 	fmt.Println("Initializing S3 client…")
 	s3Client, err := services.GetS3Client()
 	if err != nil {
@@ -30,132 +86,253 @@ func RetrieveVPCFlowLogs() ([]VPCFlowLogRecord, error) {
 		return nil, err
 	}
 
-	cacheKey := fmt.Sprintf("%s-%s-%s", year, month, day)
-	metaKey := cacheKey + "-meta"
+	date := fmt.Sprintf("%s-%s-%s", year, month, day)
+	dataset := Dataset{Bucket: bucket, Prefix: prefix, Account: account, Region: region, FormatVersion: cacheFormatVersion}
 
-	fmt.Printf("➡ Selected date: %s-%s-%s\n", year, month, day)
+	fmt.Printf("➡ Selected date: %s\n", date)
 
-	if cache.Exists(metaKey) {
-		fmt.Println("📦 Cache exists. Loading metadata…")
-		meta, err := cache.Load[map[string]interface{}](metaKey)
-		if err != nil {
+	manifest, err := dataset.loadManifest(ctx, store, date)
+	if err != nil {
+		return nil, err
+	}
+	if shared, ok := store.(*cache.Tiered); ok && manifest != nil && !manifest.Complete {
+		if manifest, err = sharedDay(ctx, shared, dataset, date, manifest); err != nil {
 			return nil, err
 		}
+	}
+	if manifest != nil && manifest.Complete {
+		fmt.Printf("📦 Cache exists in %s\n", dataset.Namespace())
+		return &dayCache{store: store, dataset: dataset, date: date, manifest: manifest}, nil
+	}
 
-		chunks := int(meta["chunks"].(float64))
-		fmt.Printf("📦 Loading %d chunks in parallel…\n", chunks)
+	base := path.Join("AWSLogs", account, "vpcflowlogs", region, year, month, day)
+	if prefix != "" {
+		base = path.Join(prefix, base)
+	}
+	finalPrefix := base + "/"
 
-		numWorkers := runtime.NumCPU()
-		if numWorkers < 2 {
-			numWorkers = 2
-		}
-		fmt.Printf("⚙️ Using %d cache loader workers\n", numWorkers)
+	fmt.Printf("📁 Bucket: %s\n", bucket)
+	fmt.Printf("📁 Prefix: %s\n", finalPrefix)
 
-		type chunkResult struct {
-			index int
-			data  []VPCFlowLogRecord
-			err   error
-		}
+	listedAt := time.Now().UTC()
+	objects, err := listObjects(ctx, s3Client, bucket, finalPrefix)
+	if err != nil {
+		return nil, err
+	}
 
-		jobs := make(chan int, chunks)
-		results := make(chan chunkResult, chunks)
+	fmt.Printf("📄 Found %d gzip files\n", len(objects))
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("no .gz files found")
+	}
 
-		var wg sync.WaitGroup
+	if manifest == nil {
+		fmt.Println("📦 No cache found, downloading from S3…")
+	} else if changed := manifest.changedObjects(objects); len(changed) > 0 {
+		fmt.Printf("♻️ %d cached objects changed or disappeared (e.g. %s), re-downloading the day…\n", len(changed), changed[0])
+		if err := dataset.invalidate(ctx, store, date, manifest); err != nil {
+			return nil, err
+		}
+		manifest = nil
+	} else {
+		fmt.Printf("📦 Partial cache in %s, refreshing with new objects…\n", dataset.Namespace())
+	}
+	if manifest == nil {
+		manifest = &Manifest{Dataset: dataset, Date: date, Objects: make(map[string]ObjectInfo)}
+	}
 
-		for w := 0; w < numWorkers; w++ {
-			wg.Add(1)
-			go func(workerID int) {
-				defer wg.Done()
+	var pending []string
+	for key := range objects {
+		if _, cached := manifest.Objects[key]; !cached {
+			pending = append(pending, key)
+		}
+	}
 
-				for idx := range jobs {
-					fn := fmt.Sprintf("%s-part-%05d", cacheKey, idx)
-					fmt.Printf("📥 Worker %d loading %s\n", workerID, fn)
+	var failed map[string]error
+	if len(pending) > 0 {
+		chunks, failedObjects, err := downloadObjects(ctx, s3Client, bucket, pending, objects, store, dataset, date, len(manifest.Chunks))
+		if err != nil {
+			return nil, err
+		}
+		failed = failedObjects
+		if maxFailed := config.GetEnvInt("MAX_FAILED_OBJECTS"); len(failed) > maxFailed {
+			printCompleteness(len(objects), len(objects)-len(failed), failed)
+			return nil, fmt.Errorf("%d objects failed to download, more than MAX_FAILED_OBJECTS=%d", len(failed), maxFailed)
+		}
 
-					part, err := cache.Load[[]VPCFlowLogRecord](fn)
-					results <- chunkResult{index: idx, data: part, err: err}
-				}
-			}(w)
+		var total int64
+		for _, c := range chunks {
+			total += int64(c.Records)
 		}
+		fmt.Printf("📊 Total processed: %d records in %d new files\n", total, len(pending)-len(failed))
+		manifest.Chunks = append(manifest.Chunks, chunks...)
+		manifest.Total += total
+	} else {
+		fmt.Println("✅ No new objects since the last run")
+	}
 
-		for i := 1; i <= chunks; i++ {
-			jobs <- i
+	// Failed objects stay out of the manifest so the next run downloads them again
+	for _, key := range pending {
+		if _, bad := failed[key]; !bad {
+			manifest.Objects[key] = objects[key]
 		}
-		close(jobs)
+	}
+	printCompleteness(len(objects), len(objects)-len(failed), failed)
 
-		go func() {
-			wg.Wait()
-			close(results)
-		}()
+	manifest.ListedAt = listedAt
+	manifest.Complete = dayComplete(date, listedAt) && len(failed) == 0
+
+	fmt.Println("💾 Saving manifest…")
+	if err := cache.Save(ctx, store, dataset.manifestKey(date), manifest); err != nil {
+		return nil, err
+	}
 
-		all := make([][]VPCFlowLogRecord, chunks)
+	return &dayCache{store: store, dataset: dataset, date: date, manifest: manifest, updated: true}, nil
+}
 
-		for r := range results {
-			if r.err != nil {
-				return nil, r.err
-			}
-			all[r.index-1] = r.data
-		}
+// sharedDay replaces a partial local day by the shared one once another user completed it
+func sharedDay(ctx context.Context, shared *cache.Tiered, dataset Dataset, date string, local *Manifest) (*Manifest, error) {
+	remote, err := dataset.loadManifest(ctx, shared.Remote, date)
+	if err != nil || remote == nil || !remote.Complete {
+		return local, nil
+	}
+
+	fmt.Printf("📦 Shared cache has the complete day, replacing the partial local copy…\n")
+	if err := dataset.invalidate(ctx, shared.Local, date, local); err != nil {
+		return nil, err
+	}
+	return dataset.loadManifest(ctx, shared, date)
+}
 
-		var merged []VPCFlowLogRecord
-		for _, part := range all {
-			merged = append(merged, part...)
+// publish uploads a complete day to the shared cache when this run wrote it or the shared
+// cache lacks it, chunks and rollup before the manifest referencing them. Partial days stay
+// local: their chunks are numbered in download order, which differs between users.
+func (dc *dayCache) publish(ctx context.Context, shared *cache.Tiered) {
+	m := dc.manifest
+	manifestKey := dc.dataset.manifestKey(dc.date) + cache.JSON.Ext()
+	if !m.Complete {
+		return
+	}
+	if !dc.updated {
+		if exists, err := shared.Remote.Exists(ctx, manifestKey); err != nil || exists {
+			return
 		}
+	}
 
-		fmt.Printf("✅ Loaded %d flow records from cache\n", len(merged))
-		return merged, nil
+	keys := make([]string, 0, len(m.Chunks)+2)
+	for i, c := range m.Chunks {
+		keys = append(keys, dc.dataset.chunkKey(dc.date, i+1)+cacheCodec(c.Format).Ext())
 	}
+	if m.Rollup != nil {
+		keys = append(keys, dc.dataset.rollupKey(dc.date)+cache.JSON.Ext())
+	}
+	keys = append(keys, manifestKey)
 
-	fmt.Println("📦 No cache found, downloading from S3…")
+	fmt.Printf("📤 Publishing %s to the shared cache…\n", dc.date)
+	for _, key := range keys {
+		if err := shared.Publish(ctx, key); err != nil {
+			fmt.Printf("⚠️ Warning: shared cache: %v\n", err)
+			return
+		}
+	}
+}
 
-	base := path.Join("AWSLogs", account, "vpcflowlogs", region, year, month, day)
-	if prefix != "" {
-		base = path.Join(prefix, base)
+// localTier is store without its shared cache
+func localTier(store cache.Cache) cache.Cache {
+	if shared, ok := store.(*cache.Tiered); ok {
+		return shared.Local
 	}
-	finalPrefix := base + "/"
+	return store
+}
 
-	fmt.Printf("📁 Bucket: %s\n", bucket)
-	fmt.Printf("📁 Prefix: %s\n", finalPrefix)
+func (dc *dayCache) records(ctx context.Context) ([]VPCFlowLogRecord, error) {
+	fmt.Printf("📦 Loading %d chunks in parallel…\n", len(dc.manifest.Chunks))
+	records, err := loadChunks(ctx, dc.store, dc.dataset, dc.date, dc.manifest.Chunks)
+	if err != nil {
+		return nil, err
+	}
+
+	dc.touch(ctx)
+	fmt.Printf("✅ Loaded %d flow records from cache\n", len(records))
+	return records, nil
+}
 
-	input := &s3.ListObjectsV2Input{Bucket: &bucket, Prefix: &finalPrefix}
+// touch marks the day as used for LRU eviction
+func (dc *dayCache) touch(ctx context.Context) {
+	if err := cache.Touch(ctx, dc.store, dc.dataset.manifestKey(dc.date), cache.JSON); err != nil {
+		fmt.Printf("⚠️ Warning: unable to mark cache entry as used: %v\n", err)
+	}
+}
+
+func listObjects(ctx context.Context, s3Client *s3.Client, bucket, prefix string) (map[string]ObjectInfo, error) {
+	input := &s3.ListObjectsV2Input{Bucket: &bucket, Prefix: &prefix}
 	paginator := s3.NewListObjectsV2Paginator(s3Client, input)
 
 	fmt.Println("🔍 Listing S3 objects…")
 
-	var files []string
+	objects := make(map[string]ObjectInfo)
 	for paginator.HasMorePages() {
 		page, err := paginator.NextPage(ctx)
 		if err != nil {
 			return nil, err
 		}
 		for _, obj := range page.Contents {
-			if strings.HasSuffix(*obj.Key, ".gz") {
-				files = append(files, *obj.Key)
+			if !strings.HasSuffix(*obj.Key, ".gz") {
+				continue
+			}
+			info := ObjectInfo{}
+			if obj.ETag != nil {
+				info.ETag = *obj.ETag
+			}
+			if obj.Size != nil {
+				info.Size = *obj.Size
 			}
+			objects[*obj.Key] = info
 		}
 	}
+	return objects, nil
+}
 
-	fmt.Printf("📄 Found %d gzip files\n", len(files))
-	if len(files) == 0 {
-		return nil, fmt.Errorf("no .gz files found")
-	}
+// downloadObjects parses the given objects into new cache chunks numbered after firstChunk
+// and returns them in order, with the objects that failed after retries. Records of a
+// failed object are never written. Any failed chunk write fails the whole download.
+// Downloads, parsing and chunk writes run in separate worker pools.
+func downloadObjects(ctx context.Context, s3Client *s3.Client, bucket string, files []string, objects map[string]ObjectInfo, store cache.Cache, dataset Dataset, date string, firstChunk int) ([]ChunkInfo, map[string]error, error) {
+	numDownloaders := concurrency("DOWNLOAD_CONCURRENCY", 4*runtime.NumCPU())
+	numParsers := concurrency("PARSE_CONCURRENCY", runtime.NumCPU())
+	numWriters := concurrency("WRITE_CONCURRENCY", runtime.NumCPU()/2)
 
-	numWorkers := runtime.NumCPU()
-	numWriters := runtime.NumCPU() / 2
-	if numWriters < 1 {
-		numWriters = 1
+	fmt.Printf("⚙️ Using %d S3 downloads, %d parsers and %d writers\n", numDownloaders, numParsers, numWriters)
+
+	dl, err := newDownloader(s3Client, bucket, numDownloaders)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	fmt.Printf("⚙️ Using %d S3 workers\n", numWorkers)
-	fmt.Printf("⚙️ Using %d writer goroutines\n", numWriters)
+	type object struct {
+		key  string
+		data []byte
+	}
 
 	fileCh := make(chan string, len(files))
-	batchCh := make(chan []VPCFlowLogRecord, numWorkers*2)
+	dataCh := make(chan object, numParsers)
+	batchCh := make(chan []VPCFlowLogRecord, numParsers*2)
 
-	var wgWorkers sync.WaitGroup
-	var wgWriters sync.WaitGroup
+	var wgDownloaders, wgParsers, wgWriters sync.WaitGroup
 
-	var chunkIndex int64 = 0
-	var total int64 = 0
+	chunkIndex := int64(firstChunk)
+	format := cacheFormat()
+
+	var mu sync.Mutex
+	written := make(map[int]ChunkInfo)
+	var writeErr error
+	failed := make(map[string]error)
+
+	fail := func(key string, err error) {
+		mu.Lock()
+		failed[key] = err
+		mu.Unlock()
+		fmt.Printf("❌ Failed %s: %v\n", key, err)
+	}
 
 	for i := 0; i < numWriters; i++ {
 		wgWriters.Add(1)
@@ -164,72 +341,50 @@ func RetrieveVPCFlowLogs() ([]VPCFlowLogRecord, error) {
 
 			for batch := range batchCh {
 				idx := atomic.AddInt64(&chunkIndex, 1)
-				fn := fmt.Sprintf("%s-part-%05d", cacheKey, idx)
+				fn := dataset.chunkKey(date, int(idx))
 
 				fmt.Printf("💾 Writer %d saving %s (%d records)\n", writerID, fn, len(batch))
-				if err := cache.Save(fn, batch); err != nil {
+				start := time.Now()
+				info, err := cache.Write(ctx, store, fn, cacheCodec(format), batch)
+				dl.stats.addWrite(time.Since(start))
+
+				mu.Lock()
+				if err != nil {
 					fmt.Printf("❌ Writer %d error saving %s: %v\n", writerID, fn, err)
+					if writeErr == nil {
+						writeErr = fmt.Errorf("save %s: %w", fn, err)
+					}
+				} else {
+					written[int(idx)] = ChunkInfo{Format: format, Records: len(batch), Info: info}
 				}
-
-				atomic.AddInt64(&total, int64(len(batch)))
+				mu.Unlock()
 			}
 		}(i)
 	}
 
-	for w := 0; w < numWorkers; w++ {
-		wgWorkers.Add(1)
-		go func(workerID int) {
-			defer wgWorkers.Done()
+	for p := 0; p < numParsers; p++ {
+		wgParsers.Add(1)
+		go func() {
+			defer wgParsers.Done()
 
 			local := make([]VPCFlowLogRecord, 0, 100000)
 
-			for key := range fileCh {
-				fmt.Printf("⬇ Worker %d downloading %s\n", workerID, key)
-
-				out, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
-					Bucket: &bucket,
-					Key:    &key,
-				})
+			for obj := range dataCh {
+				start := time.Now()
+				records, err := parseObject(obj.data)
+				dl.stats.addParse(len(records), time.Since(start))
 				if err != nil {
-					fmt.Printf("❌ Worker %d S3 error: %v\n", workerID, err)
+					fail(obj.key, err)
 					continue
 				}
 
-				gzr, err := gzip.NewReader(out.Body)
-				if err != nil {
-					fmt.Printf("❌ Worker %d gzip error: %v\n", workerID, err)
-					continue
+				local = append(local, records...)
+				if len(local) >= 100000 {
+					b := make([]VPCFlowLogRecord, len(local))
+					copy(b, local)
+					batchCh <- b
+					local = local[:0]
 				}
-
-				r := bufio.NewReaderSize(gzr, 256*1024)
-				for {
-					line, err := r.ReadBytes('\n')
-					if err != nil {
-						break
-					}
-					if strings.HasPrefix(string(line), "version") {
-						continue
-					}
-
-					rec, err := ParseFlowLogLine(string(line))
-					if err != nil {
-						continue
-					}
-
-					rec.Direction = FlowDirection(*rec)
-
-					local = append(local, *rec)
-
-					if len(local) >= 100000 {
-						b := make([]VPCFlowLogRecord, len(local))
-						copy(b, local)
-						batchCh <- b
-						local = local[:0]
-					}
-				}
-
-				gzr.Close()
-				fmt.Printf("✔️ Worker %d finished %s\n", workerID, key)
 			}
 
 			if len(local) > 0 {
@@ -237,6 +392,24 @@ func RetrieveVPCFlowLogs() ([]VPCFlowLogRecord, error) {
 				copy(b, local)
 				batchCh <- b
 			}
+		}()
+	}
+
+	for w := 0; w < numDownloaders; w++ {
+		wgDownloaders.Add(1)
+		go func(workerID int) {
+			defer wgDownloaders.Done()
+
+			for key := range fileCh {
+				fmt.Printf("⬇ Worker %d downloading %s\n", workerID, key)
+				data, err := dl.fetch(ctx, key, objects[key])
+				if err != nil {
+					fail(key, err)
+					continue
+				}
+				fmt.Printf("✔️ Worker %d finished %s\n", workerID, key)
+				dataCh <- object{key: key, data: data}
+			}
 		}(w)
 	}
 
@@ -248,30 +421,39 @@ func RetrieveVPCFlowLogs() ([]VPCFlowLogRecord, error) {
 	}()
 
 	go func() {
-		wgWorkers.Wait()
+		wgDownloaders.Wait()
+		close(dataCh)
+		wgParsers.Wait()
 		close(batchCh)
 	}()
 
 	wgWriters.Wait()
+	dl.printStats(len(files) - len(failed))
 
-	fmt.Printf("📊 Total processed: %d records\n", total)
-
-	meta := map[string]interface{}{
-		"total":  total,
-		"chunks": chunkIndex,
+	if writeErr != nil {
+		return nil, nil, writeErr
 	}
 
-	fmt.Println("💾 Saving metadata…")
-	if err := cache.Save(metaKey, meta); err != nil {
-		return nil, err
+	chunks := make([]ChunkInfo, 0, len(written))
+	for idx := firstChunk + 1; idx <= int(chunkIndex); idx++ {
+		chunks = append(chunks, written[idx])
 	}
+	return chunks, failed, nil
+}
 
-	fmt.Println("📦 Reloading full logs from chunks…")
-
-	var all []VPCFlowLogRecord
-	chunks := int(chunkIndex)
+// concurrency reads a worker count, 0 or unset picks auto (at least 1)
+func concurrency(key string, auto int) int {
+	if n := config.GetEnvInt(key); n > 0 {
+		return n
+	}
+	return max(auto, 1)
+}
 
-	numWorkers = runtime.NumCPU()
+// loadChunks reads the cached chunks of a day in parallel, in chunk order, verifying each
+// against its manifest entry
+func loadChunks(ctx context.Context, store cache.Cache, dataset Dataset, date string, infos []ChunkInfo) ([]VPCFlowLogRecord, error) {
+	chunks := len(infos)
+	numWorkers := runtime.NumCPU()
 	if numWorkers < 2 {
 		numWorkers = 2
 	}
@@ -294,10 +476,16 @@ func RetrieveVPCFlowLogs() ([]VPCFlowLogRecord, error) {
 			defer wg.Done()
 
 			for idx := range jobs {
-				fn := fmt.Sprintf("%s-part-%05d", cacheKey, idx)
+				fn := dataset.chunkKey(date, idx)
 				fmt.Printf("📥 Worker %d loading %s\n", workerID, fn)
 
-				part, err := cache.Load[[]VPCFlowLogRecord](fn)
+				info := infos[idx-1]
+				part, err := cache.LoadVerified[[]VPCFlowLogRecord](ctx, store, fn, cacheCodec(info.Format), info.Info)
+				if err != nil {
+					err = fmt.Errorf("load %s: %w", fn, err)
+				} else if len(part) != info.Records {
+					err = fmt.Errorf("%w: %s has %d records, expected %d", cache.ErrCorrupt, fn, len(part), info.Records)
+				}
 				results <- chunkResult{index: idx, data: part, err: err}
 			}
 		}(w)
@@ -322,10 +510,9 @@ func RetrieveVPCFlowLogs() ([]VPCFlowLogRecord, error) {
 		allParts[r.index-1] = r.data
 	}
 
+	var all []VPCFlowLogRecord
 	for _, part := range allParts {
 		all = append(all, part...)
 	}
-
-	fmt.Printf("🎉 Completed. Total logs: %d\n", len(all))
 	return all, nil
 }
@@ -0,0 +1,178 @@
+package flow_logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
+	"vpc_flowlogs_egress_analyzer/internal/config"
+	"vpc_flowlogs_egress_analyzer/internal/metrics"
+	"vpc_flowlogs_egress_analyzer/internal/report"
+	"vpc_flowlogs_egress_analyzer/internal/sqlite"
+)
+
+const (
+	FormatJSON        = "json"
+	FormatHTML        = "html"
+	FormatCSV         = "csv"
+	FormatNDJSON      = "ndjson"
+	FormatMarkdown    = "markdown"
+	FormatOpenMetrics = "openmetrics"
+	FormatSQLite      = "sqlite"
+)
+
+func outputFormats() []string {
+	var formats []string
+	for _, f := range strings.Split(config.GetEnv("OUTPUT_FORMATS"), ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f != "" {
+			formats = append(formats, f)
+		}
+	}
+	return formats
+}
+
+// needsRecords reports whether an output exports individual flows, which rollups lack
+func needsRecords() bool {
+	for _, f := range outputFormats() {
+		if f == FormatSQLite && config.GetEnv("SQLITE_FLOWS") != sqlite.FlowsNone {
+			return true
+		}
+	}
+	return false
+}
+
+func writeOutputs(rep report.Report, logs []VPCFlowLogRecord) {
+	dir := config.GetEnv("OUTPUT_DIR")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Printf("❌ Error creating output directory %s: %v\n", dir, err)
+		return
+	}
+
+	for _, format := range outputFormats() {
+		switch format {
+		case FormatJSON:
+			writeOutputFile(dir, "result.json", func(w io.Writer) error {
+				enc := json.NewEncoder(w)
+				enc.SetIndent("", "  ")
+				return enc.Encode(rep)
+			})
+		case FormatHTML:
+			writeOutputFile(dir, "report.html", func(w io.Writer) error {
+				return report.WriteHTML(w, rep)
+			})
+		case FormatMarkdown:
+			prev := previousResult()
+			writeOutputFile(dir, "report.md", func(w io.Writer) error {
+				return report.WriteMarkdown(w, rep, prev, config.GetEnvInt("MARKDOWN_TOP_N"))
+			})
+		case FormatOpenMetrics:
+			fpath := config.GetEnv("METRICS_FILE")
+			if fpath == "" {
+				fpath = filepath.Join(dir, "vpc_egress.prom")
+			}
+			if err := metrics.WriteFile(fpath, rep, config.GetEnvInt("METRICS_TOP_N")); err != nil {
+				fmt.Printf("❌ Error writing %s: %v\n", fpath, err)
+				continue
+			}
+			fmt.Printf("💾 Saved %s\n", fpath)
+		case FormatSQLite:
+			fpath := config.GetEnv("SQLITE_FILE")
+			if fpath == "" {
+				fpath = filepath.Join(dir, "egress.sqlite")
+			}
+			if err := sqlite.Write(fpath, rep, sqliteFlows(logs), config.GetEnv("SQLITE_FLOWS")); err != nil {
+				fmt.Printf("❌ Error writing %s: %v\n", fpath, err)
+				continue
+			}
+			fmt.Printf("💾 Saved %s\n", fpath)
+		case FormatCSV, FormatNDJSON:
+			for _, t := range report.Tables(rep) {
+				table := t
+				writeOutputFile(dir, table.Name+"."+format, func(w io.Writer) error {
+					if format == FormatCSV {
+						return report.WriteCSV(w, table)
+					}
+					return report.WriteNDJSON(w, table)
+				})
+			}
+		default:
+			fmt.Printf("⚠️ Warning: unknown output format %q\n", format)
+		}
+	}
+}
+
+func writeOutputFile(dir, name string, write func(io.Writer) error) {
+	fpath := filepath.Join(dir, name)
+	f, err := os.Create(fpath)
+	if err != nil {
+		fmt.Printf("❌ Error creating %s: %v\n", fpath, err)
+		return
+	}
+	defer f.Close()
+
+	if err := write(f); err != nil {
+		fmt.Printf("❌ Error writing %s: %v\n", fpath, err)
+		return
+	}
+
+	fmt.Printf("💾 Saved %s\n", fpath)
+}
+
+// sqliteFlows resolves source and destination the same way the analysis does
+func sqliteFlows(logs []VPCFlowLogRecord) iter.Seq[sqlite.Flow] {
+	return func(yield func(sqlite.Flow) bool) {
+		for _, r := range logs {
+			src := r.PktSrcAddr
+			if src == "" || src == "-" {
+				src = r.SrcAddr
+			}
+			dst := r.PktDstAddr
+			if dst == "" || dst == "-" {
+				dst = r.DstAddr
+			}
+			service := r.PktDstAwsService
+			if r.Direction != "egress" {
+				service = r.PktSrcAwsService
+			}
+			if service == "-" {
+				service = ""
+			}
+			f := sqlite.Flow{
+				Start:       r.Start,
+				End:         r.End,
+				InterfaceID: r.InterfaceID,
+				Direction:   r.Direction,
+				Action:      r.Action,
+				Source:      src,
+				Destination: dst,
+				SrcPort:     r.SrcPort,
+				DstPort:     r.DstPort,
+				Protocol:    r.Protocol,
+				AwsService:  service,
+				Packets:     r.Packets,
+				Bytes:       r.Bytes,
+			}
+			if !yield(f) {
+				return
+			}
+		}
+	}
+}
+
+// previousResult loads PREVIOUS_RESULT, used to show deltas
+func previousResult() *report.Report {
+	path := config.GetEnv("PREVIOUS_RESULT")
+	if path == "" {
+		return nil
+	}
+	prev, err := report.Load(path)
+	if err != nil {
+		fmt.Printf("⚠️ Warning: ignoring previous result: %v\n", err)
+		return nil
+	}
+	return prev
+}
@@ -0,0 +1,79 @@
+package flow_logs
+
+import "fmt"
+
+// IANA protocol numbers as found in the ${protocol} field
+var protocolNames = map[int]string{
+	1:   "ICMP",
+	2:   "IGMP",
+	6:   "TCP",
+	17:  "UDP",
+	41:  "IPv6",
+	47:  "GRE",
+	50:  "ESP",
+	51:  "AH",
+	58:  "ICMPv6",
+	132: "SCTP",
+}
+
+// Destination ports worth naming in reports
+var wellKnownPorts = map[int]string{
+	20:    "FTP-DATA",
+	21:    "FTP",
+	22:    "SSH",
+	25:    "SMTP",
+	53:    "DNS",
+	80:    "HTTP",
+	110:   "POP3",
+	123:   "NTP",
+	143:   "IMAP",
+	389:   "LDAP",
+	443:   "HTTPS",
+	465:   "SMTPS",
+	500:   "IKE",
+	587:   "SMTP-SUBMISSION",
+	636:   "LDAPS",
+	853:   "DNS-over-TLS",
+	993:   "IMAPS",
+	995:   "POP3S",
+	1433:  "MSSQL",
+	1521:  "ORACLE",
+	2049:  "NFS",
+	2181:  "ZOOKEEPER",
+	2375:  "DOCKER",
+	2376:  "DOCKER-TLS",
+	3306:  "MYSQL",
+	3389:  "RDP",
+	4500:  "IPSEC-NAT-T",
+	5044:  "BEATS",
+	5432:  "POSTGRESQL",
+	5671:  "AMQPS",
+	5672:  "AMQP",
+	6379:  "REDIS",
+	6443:  "KUBERNETES-API",
+	8080:  "HTTP-ALT",
+	8443:  "HTTPS-ALT",
+	9092:  "KAFKA",
+	9093:  "KAFKA-TLS",
+	9200:  "ELASTICSEARCH",
+	9243:  "ELASTIC-CLOUD",
+	9418:  "GIT",
+	11211: "MEMCACHED",
+	27017: "MONGODB",
+}
+
+func ProtocolName(protocol int) string {
+	if name, ok := protocolNames[protocol]; ok {
+		return name
+	}
+	return fmt.Sprintf("PROTO-%d", protocol)
+}
+
+func PortServiceName(port int) string {
+	return wellKnownPorts[port]
+}
+
+// Ports are only meaningful for TCP, UDP and SCTP, other protocols report 0
+func HasPorts(protocol int) bool {
+	return protocol == 6 || protocol == 17 || protocol == 132
+}
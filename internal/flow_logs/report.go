@@ -0,0 +1,225 @@
+package flow_logs
+
+import (
+	"sort"
+	"time"
+	"vpc_flowlogs_egress_analyzer/internal/config"
+	"vpc_flowlogs_egress_analyzer/internal/cost"
+	"vpc_flowlogs_egress_analyzer/internal/report"
+)
+
+const topPortsPerIP = 5
+
+func buildReport(summary AnalysisSummary) report.Report {
+	entries := make([]report.IPEntry, 0, len(summary.ByIP))
+	for ip, st := range summary.ByIP {
+		entries = append(entries, report.IPEntry{
+			IP:            ip,
+			AwsService:    st.AwsService,
+			AwsRegion:     st.AwsRegion,
+			Direction:     st.Direction,
+			Bytes:         st.Bytes,
+			GB:            st.GB,
+			CostUSD:       st.CostUSD,
+			ConnectionNum: st.ConnectionNum,
+			TopPorts:      topPorts(st.Ports, topPortsPerIP),
+			Hostname:      st.Hostname,
+			IpInfo:        st.IpInfo,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Bytes != entries[j].Bytes {
+			return entries[i].Bytes > entries[j].Bytes
+		}
+		return entries[i].IP < entries[j].IP
+	})
+
+	return report.Report{
+		Year:         summary.Year,
+		Month:        summary.Month,
+		Day:          summary.Day,
+		Region:       summary.Region,
+		CostPerGBUSD: summary.CostPerGBUSD,
+		Total: report.Total{
+			Bytes:   summary.Total.Bytes,
+			GB:      summary.Total.GB,
+			CostUSD: summary.Total.CostUSD,
+		},
+		EgressByIP:         entries,
+		EgressBySource:     sourceEntries(summary.BySource),
+		EgressByProtocol:   protocolEntries(summary.ByProtocol),
+		EgressByPort:       topPorts(summary.ByPort, 0),
+		EgressByAwsService: serviceEntries(summary.ByService, summary.Region),
+		EgressByHour:       hourEntries(summary.ByHour),
+		EgressByPair:       pairEntries(summary.ByPair, summary.ByIP, config.GetEnvInt("PAIR_TOP_N")),
+		AwsTrafficByRegionScope: report.RegionScope{
+			InRegion:      trafficEntry(summary.AwsScope.InRegion),
+			CrossRegion:   trafficEntry(summary.AwsScope.CrossRegion),
+			UnknownRegion: trafficEntry(summary.AwsScope.UnknownRegion),
+		},
+		Recommendations: summary.Recommendations,
+	}
+}
+
+func trafficEntry(st TrafficStats) report.Traffic {
+	return report.Traffic{
+		Bytes:         st.Bytes,
+		GB:            st.GB,
+		CostUSD:       st.CostUSD,
+		ConnectionNum: st.ConnectionNum,
+	}
+}
+
+func sourceEntries(bySource map[string]*SourceStats) []report.SourceEntry {
+	entries := make([]report.SourceEntry, 0, len(bySource))
+	for src, st := range bySource {
+		eni, eniBytes := "", -1
+		for id, b := range st.Interfaces {
+			if b > eniBytes || (b == eniBytes && id < eni) {
+				eni, eniBytes = id, b
+			}
+		}
+		entries = append(entries, report.SourceEntry{
+			Source:        src,
+			InterfaceID:   eni,
+			Bytes:         st.Bytes,
+			GB:            st.GB,
+			CostUSD:       st.CostUSD,
+			ConnectionNum: st.ConnectionNum,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Bytes != entries[j].Bytes {
+			return entries[i].Bytes > entries[j].Bytes
+		}
+		return entries[i].Source < entries[j].Source
+	})
+	return entries
+}
+
+// pairEntries returns the biggest destination/source pairs, limit <= 0 means no limit
+func pairEntries(byPair map[PairKey]*TrafficStats, byIP map[string]*IPStats, limit int) []report.PairEntry {
+	entries := make([]report.PairEntry, 0, len(byPair))
+	for key, st := range byPair {
+		service := ""
+		if dst, ok := byIP[key.Destination]; ok {
+			service = dst.AwsService
+		}
+		entries = append(entries, report.PairEntry{
+			Destination:   key.Destination,
+			AwsService:    service,
+			Source:        key.Source,
+			InterfaceID:   key.InterfaceID,
+			Bytes:         st.Bytes,
+			GB:            st.GB,
+			CostUSD:       st.CostUSD,
+			ConnectionNum: st.ConnectionNum,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Bytes != entries[j].Bytes {
+			return entries[i].Bytes > entries[j].Bytes
+		}
+		if entries[i].Destination != entries[j].Destination {
+			return entries[i].Destination < entries[j].Destination
+		}
+		if entries[i].Source != entries[j].Source {
+			return entries[i].Source < entries[j].Source
+		}
+		return entries[i].InterfaceID < entries[j].InterfaceID
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+func hourEntries(byHour map[int64]*TrafficStats) []report.HourEntry {
+	entries := make([]report.HourEntry, 0, len(byHour))
+	for hour, st := range byHour {
+		entries = append(entries, report.HourEntry{
+			Hour:          time.Unix(hour, 0).UTC().Format(time.RFC3339),
+			Unix:          hour,
+			Bytes:         st.Bytes,
+			GB:            st.GB,
+			CostUSD:       st.CostUSD,
+			ConnectionNum: st.ConnectionNum,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Unix < entries[j].Unix
+	})
+	return entries
+}
+
+func protocolEntries(byProtocol map[int]*TrafficStats) []report.ProtocolEntry {
+	entries := make([]report.ProtocolEntry, 0, len(byProtocol))
+	for proto, st := range byProtocol {
+		entries = append(entries, report.ProtocolEntry{
+			Protocol:      ProtocolName(proto),
+			Number:        proto,
+			Bytes:         st.Bytes,
+			GB:            st.GB,
+			CostUSD:       st.CostUSD,
+			ConnectionNum: st.ConnectionNum,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Bytes != entries[j].Bytes {
+			return entries[i].Bytes > entries[j].Bytes
+		}
+		return entries[i].Number < entries[j].Number
+	})
+	return entries
+}
+
+func serviceEntries(byService map[ServiceKey]*TrafficStats, region string) []report.ServiceEntry {
+	entries := make([]report.ServiceEntry, 0, len(byService))
+	for key, st := range byService {
+		entries = append(entries, report.ServiceEntry{
+			Service:       key.Service,
+			Region:        key.Region,
+			CrossRegion:   cost.CrossRegion(region, key.Region),
+			Bytes:         st.Bytes,
+			GB:            st.GB,
+			CostUSD:       st.CostUSD,
+			ConnectionNum: st.ConnectionNum,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Bytes != entries[j].Bytes {
+			return entries[i].Bytes > entries[j].Bytes
+		}
+		if entries[i].Service != entries[j].Service {
+			return entries[i].Service < entries[j].Service
+		}
+		return entries[i].Region < entries[j].Region
+	})
+	return entries
+}
+
+// topPorts returns ports sorted by bytes, limit <= 0 means no limit
+func topPorts(byPort map[int]*TrafficStats, limit int) []report.PortEntry {
+	entries := make([]report.PortEntry, 0, len(byPort))
+	for port, st := range byPort {
+		entries = append(entries, report.PortEntry{
+			Port:          port,
+			Service:       PortServiceName(port),
+			Bytes:         st.Bytes,
+			GB:            st.GB,
+			CostUSD:       st.CostUSD,
+			ConnectionNum: st.ConnectionNum,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Bytes != entries[j].Bytes {
+			return entries[i].Bytes > entries[j].Bytes
+		}
+		return entries[i].Port < entries[j].Port
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
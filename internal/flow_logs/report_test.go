@@ -0,0 +1,58 @@
+package flow_logs
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestBuildReportOrdersTies(t *testing.T) {
+	summary := AnalysisSummary{
+		ByIP:       map[string]*IPStats{},
+		BySource:   map[string]*SourceStats{},
+		ByProtocol: map[int]*TrafficStats{},
+		ByPort:     map[int]*TrafficStats{},
+		ByService:  map[ServiceKey]*TrafficStats{},
+	}
+	for _, ip := range []string{"8.8.8.8", "1.1.1.1", "52.94.0.1", "9.9.9.9"} {
+		summary.ByIP[ip] = &IPStats{Bytes: 100}
+		summary.BySource["10.0.0."+ip[:1]] = &SourceStats{TrafficStats: TrafficStats{Bytes: 100}}
+	}
+	summary.ByIP["9.9.9.9"].Bytes = 200
+	for _, proto := range []int{17, 6, 1} {
+		summary.ByProtocol[proto] = &TrafficStats{Bytes: 100}
+		summary.ByPort[proto+440] = &TrafficStats{Bytes: 100}
+	}
+	for _, key := range []ServiceKey{{"S3", "us-east-1"}, {"S3", "eu-west-3"}, {"ECR", "eu-west-3"}} {
+		summary.ByService[key] = &TrafficStats{Bytes: 100}
+	}
+
+	r := buildReport(summary)
+	var got []string
+	for _, e := range r.EgressByIP {
+		got = append(got, e.IP)
+	}
+	for _, e := range r.EgressBySource {
+		got = append(got, e.Source)
+	}
+	for _, e := range r.EgressByProtocol {
+		got = append(got, fmt.Sprint(e.Number))
+	}
+	for _, e := range r.EgressByPort {
+		got = append(got, fmt.Sprint(e.Port))
+	}
+	for _, e := range r.EgressByAwsService {
+		got = append(got, e.Service+"/"+e.Region)
+	}
+
+	want := []string{
+		"9.9.9.9", "1.1.1.1", "52.94.0.1", "8.8.8.8",
+		"10.0.0.1", "10.0.0.5", "10.0.0.8", "10.0.0.9",
+		"1", "6", "17",
+		"441", "446", "457",
+		"ECR/eu-west-3", "S3/eu-west-3", "S3/us-east-1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, expected %v", got, want)
+	}
+}
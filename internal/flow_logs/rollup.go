@@ -0,0 +1,130 @@
+package flow_logs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"vpc_flowlogs_egress_analyzer/internal/cache"
+)
+
+// RollupRow is the egress traffic of one source to one destination port over one ENI, for
+// an AWS service and UTC hour. It holds everything the analysis needs, raw records are
+// only loaded for outputs that export individual flows.
+type RollupRow struct {
+	Source      string `json:"src"`
+	Destination string `json:"dst"`
+	InterfaceID string `json:"eni"`
+	Port        int    `json:"port"`
+	Protocol    int    `json:"proto"`
+	Service     string `json:"svc,omitempty"`
+	Hour        int64  `json:"hour"`
+	Bytes       int    `json:"bytes"`
+	Flows       int    `json:"flows"`
+	FirstSeen   int64  `json:"first"`
+	LastSeen    int64  `json:"last"`
+}
+
+// RollupInfo describes the cached rollup, built from the first Chunks chunks of the day
+type RollupInfo struct {
+	Chunks int `json:"chunks"`
+	Rows   int `json:"rows"`
+	cache.Info
+}
+
+type rollupKey struct {
+	Source      string
+	Destination string
+	InterfaceID string
+	Port        int
+	Protocol    int
+	Service     string
+	Hour        int64
+}
+
+func buildRollup(records []VPCFlowLogRecord) []RollupRow {
+	index := make(map[rollupKey]int)
+	var rows []RollupRow
+
+	for _, r := range records {
+		if r.Direction != "egress" {
+			continue
+		}
+
+		src := r.PktSrcAddr
+		if src == "" || src == "-" {
+			src = r.SrcAddr
+		}
+		dst := r.PktDstAddr
+		if dst == "" || dst == "-" {
+			dst = r.DstAddr
+		}
+		service := r.PktDstAwsService
+		if service == "-" {
+			service = ""
+		}
+
+		k := rollupKey{Source: src, Destination: dst, InterfaceID: r.InterfaceID, Port: r.DstPort, Protocol: r.Protocol, Service: service, Hour: r.Start - r.Start%3600}
+		i, exists := index[k]
+		if !exists {
+			i = len(rows)
+			index[k] = i
+			rows = append(rows, RollupRow{
+				Source: src, Destination: dst, InterfaceID: r.InterfaceID, Port: r.DstPort, Protocol: r.Protocol, Service: service, Hour: k.Hour,
+				FirstSeen: r.Start, LastSeen: r.End,
+			})
+		}
+
+		row := &rows[i]
+		row.Bytes += r.Bytes
+		row.Flows++
+		if r.Start < row.FirstSeen {
+			row.FirstSeen = r.Start
+		}
+		if r.End > row.LastSeen {
+			row.LastSeen = r.End
+		}
+	}
+	return rows
+}
+
+// rollup returns the cached rollup when it covers every chunk, otherwise builds it from the
+// raw chunks and caches it. A corrupt rollup is rebuilt the same way, the day is only
+// invalidated when its chunks are corrupt too.
+func (dc *dayCache) rollup(ctx context.Context) ([]RollupRow, error) {
+	key := dc.dataset.rollupKey(dc.date)
+
+	if r := dc.manifest.Rollup; r != nil && r.Chunks == len(dc.manifest.Chunks) {
+		rows, err := cache.LoadVerified[[]RollupRow](ctx, dc.store, key, cache.JSON, r.Info)
+		if err == nil && len(rows) != r.Rows {
+			err = fmt.Errorf("%w: %s has %d rows, expected %d", cache.ErrCorrupt, key, len(rows), r.Rows)
+		}
+		if err == nil {
+			dc.touch(ctx)
+			fmt.Printf("✅ Loaded %d rollup rows from cache\n", len(rows))
+			return rows, nil
+		}
+		if !errors.Is(err, cache.ErrCorrupt) {
+			return nil, fmt.Errorf("load %s: %w", key, err)
+		}
+		fmt.Printf("⚠️ Rebuilding cached rollup of %s from raw chunks: %v\n", dc.date, err)
+	}
+
+	records, err := dc.records(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := buildRollup(records)
+	info, err := cache.Write(ctx, dc.store, key, cache.JSON, rows)
+	if err != nil {
+		return nil, err
+	}
+	dc.manifest.Rollup = &RollupInfo{Chunks: len(dc.manifest.Chunks), Rows: len(rows), Info: info}
+	if err := cache.Save(ctx, dc.store, dc.dataset.manifestKey(dc.date), dc.manifest); err != nil {
+		return nil, err
+	}
+	dc.updated = true
+
+	fmt.Printf("💾 Cached %d rollup rows from %d records\n", len(rows), len(records))
+	return rows, nil
+}
@@ -0,0 +1,73 @@
+package flow_logs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"vpc_flowlogs_egress_analyzer/internal/cache"
+)
+
+// testDay caches records as a one chunk complete day
+func testDay(t *testing.T, store cache.Cache, records []VPCFlowLogRecord) *dayCache {
+	t.Helper()
+	ctx := context.Background()
+	dataset := Dataset{Bucket: "logs", Account: "123456789012", Region: "eu-west-3", FormatVersion: cacheFormatVersion}
+	date := "2025-12-02"
+
+	info, err := cache.Write(ctx, store, dataset.chunkKey(date, 1), recordCodec, records)
+	if err != nil {
+		t.Fatalf("write chunk: %v", err)
+	}
+	m := &Manifest{Dataset: dataset, Date: date, Complete: true, Total: int64(len(records)),
+		Chunks: []ChunkInfo{{Format: CacheFormatBinary, Records: len(records), Info: info}}}
+	return &dayCache{store: store, dataset: dataset, date: date, manifest: m}
+}
+
+func TestRollupRebuiltWhenCorrupt(t *testing.T) {
+	ctx := context.Background()
+	store := cache.NewMemory()
+	records := syntheticRecords(500)
+	dc := testDay(t, store, records)
+	want := buildRollup(records)
+
+	rows, err := dc.rollup(ctx)
+	if err != nil {
+		t.Fatalf("build rollup: %v", err)
+	}
+	if !reflect.DeepEqual(rows, want) || dc.manifest.Rollup == nil {
+		t.Fatalf("built rollup differs from the records or is not recorded in the manifest")
+	}
+
+	key := dc.dataset.rollupKey(dc.date) + cache.JSON.Ext()
+	store.Put(ctx, key, bytes.NewReader([]byte("garbage")))
+
+	rows, err = dc.rollup(ctx)
+	if err != nil {
+		t.Fatalf("a corrupt rollup must be rebuilt from intact chunks, got %v", err)
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rebuilt rollup differs from the records")
+	}
+	if _, err := cache.LoadVerified[[]RollupRow](ctx, store, dc.dataset.rollupKey(dc.date), cache.JSON, dc.manifest.Rollup.Info); err != nil {
+		t.Fatalf("rebuilt rollup was not cached: %v", err)
+	}
+}
+
+func TestRollupCorruptChunks(t *testing.T) {
+	ctx := context.Background()
+	store := cache.NewMemory()
+	dc := testDay(t, store, syntheticRecords(500))
+	if _, err := dc.rollup(ctx); err != nil {
+		t.Fatalf("build rollup: %v", err)
+	}
+
+	// Both the rollup and its chunks are damaged: only a new download can help
+	store.Put(ctx, dc.dataset.rollupKey(dc.date)+cache.JSON.Ext(), bytes.NewReader([]byte("garbage")))
+	store.Put(ctx, dc.dataset.chunkKey(dc.date, 1)+recordCodec.Ext(), bytes.NewReader([]byte("garbage")))
+
+	if _, err := dc.rollup(ctx); !errors.Is(err, cache.ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt from corrupt chunks, got %v", err)
+	}
+}
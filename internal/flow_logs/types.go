@@ -1,6 +1,10 @@
 package flow_logs
 
-import "vpc_flowlogs_egress_analyzer/internal/ipInfo"
+import (
+	"vpc_flowlogs_egress_analyzer/internal/cost"
+	"vpc_flowlogs_egress_analyzer/internal/hostnames"
+	"vpc_flowlogs_egress_analyzer/internal/ipInfo"
+)
 
 // VPCFlowLogRecord correspond exactement au format Custom attendu
 type VPCFlowLogRecord struct {
@@ -38,7 +42,37 @@ type AnalysisSummary struct {
 		CostUSD float64 `json:"cost_usd"`
 	} `json:"total"`
 
-	ByIP map[string]*IPStats `json:"-"`
+	ByIP       map[string]*IPStats          `json:"-"`
+	ByProtocol map[int]*TrafficStats        `json:"-"`
+	ByPort     map[int]*TrafficStats        `json:"-"`
+	ByService  map[ServiceKey]*TrafficStats `json:"-"`
+	BySource   map[string]*SourceStats      `json:"-"`
+	ByHour     map[int64]*TrafficStats      `json:"-"`
+	ByPair     map[PairKey]*TrafficStats    `json:"-"`
+
+	AwsScope        AwsRegionScope        `json:"-"`
+	Recommendations []cost.Recommendation `json:"-"`
+}
+
+type TrafficStats struct {
+	Bytes         int     `json:"bytes"`
+	GB            float64 `json:"gb"`
+	CostUSD       float64 `json:"cost_usd"`
+	ConnectionNum int     `json:"connection_num"`
+}
+
+func (t *TrafficStats) Merge(other *TrafficStats) {
+	t.Bytes += other.Bytes
+	t.GB += other.GB
+	t.CostUSD += other.CostUSD
+	t.ConnectionNum += other.ConnectionNum
+}
+
+func (t *TrafficStats) Add(bytes int, gb, costUSD float64, flows int) {
+	t.Bytes += bytes
+	t.GB += gb
+	t.CostUSD += costUSD
+	t.ConnectionNum += flows
 }
 
 type IPStats struct {
@@ -48,17 +82,35 @@ type IPStats struct {
 	CostUSD       float64
 	ConnectionNum int
 	AwsService    string
+	AwsRegion     string
+	FirstSeen     int64
+	LastSeen      int64
+	Hostname      *hostnames.Result
 	IpInfo        *ipInfo.IpInfoResponse
+	Ports         map[int]*TrafficStats
 }
 
-// IPEntry est la structure finale pour le JSON
-type IPEntry struct {
-	IP            string  `json:"ip"`
-	AwsService    string  `json:"aws_service,omitempty"`
-	Direction     string  `json:"direction"`
-	Bytes         int     `json:"bytes"`
-	GB            float64 `json:"gb"`
-	CostUSD       float64 `json:"cost_usd"`
-	ConnectionNum int     `json:"connection_num"`
-	IpInfo        any     `json:"ipinfo"`
+type SourceStats struct {
+	TrafficStats
+	Interfaces map[string]int // bytes per ENI
+}
+
+// AwsRegionScope splits AWS service traffic between the analyzed region and others
+type AwsRegionScope struct {
+	InRegion      TrafficStats `json:"in_region"`
+	CrossRegion   TrafficStats `json:"cross_region"`
+	UnknownRegion TrafficStats `json:"unknown_region"`
+}
+
+// ServiceKey identifies AWS service traffic by destination region, Region is empty when unknown
+type ServiceKey struct {
+	Service string
+	Region  string
+}
+
+// PairKey links a destination to a source and the ENI the flow was logged on
+type PairKey struct {
+	Destination string
+	Source      string
+	InterfaceID string
 }
@@ -0,0 +1,112 @@
+package history
+
+import (
+	"math"
+	"sort"
+	"vpc_flowlogs_egress_analyzer/internal/report"
+)
+
+type DetectOptions struct {
+	K              float64 // threshold is median + K·MAD
+	MinHistoryDays int     // days of history needed before baselines are trusted
+	MinBytes       int     // entities below this volume are never flagged
+	NewMinBytes    int     // volume from which a never seen entity is flagged
+}
+
+// Detect flags destinations and sources whose bytes exceed median + k·MAD over past
+// snapshots, or that were never seen before and already send NewMinBytes. Days where
+// an entity is absent count as 0 bytes.
+func Detect(current Snapshot, past []Snapshot, opts DetectOptions) []report.Anomaly {
+	if len(past) < opts.MinHistoryDays {
+		return nil
+	}
+
+	var anomalies []report.Anomaly
+	anomalies = append(anomalies, detect(report.AnomalyDestination, current.Destinations, past, func(s Snapshot) map[string]int { return s.Destinations }, opts)...)
+	anomalies = append(anomalies, detect(report.AnomalySource, current.Sources, past, func(s Snapshot) map[string]int { return s.Sources }, opts)...)
+
+	sort.Slice(anomalies, func(i, j int) bool {
+		if anomalies[i].Bytes != anomalies[j].Bytes {
+			return anomalies[i].Bytes > anomalies[j].Bytes
+		}
+		return anomalies[i].Key < anomalies[j].Key
+	})
+	return anomalies
+}
+
+func detect(kind string, current map[string]int, past []Snapshot, values func(Snapshot) map[string]int, opts DetectOptions) []report.Anomaly {
+	var out []report.Anomaly
+	series := make([]float64, len(past))
+
+	for key, bytes := range current {
+		if bytes < opts.MinBytes {
+			continue
+		}
+
+		seen := false
+		for i, snap := range past {
+			v, ok := values(snap)[key]
+			series[i] = float64(v)
+			seen = seen || ok
+		}
+
+		if !seen {
+			if bytes >= opts.NewMinBytes {
+				out = append(out, report.Anomaly{
+					Kind:        kind,
+					Key:         key,
+					Reason:      report.AnomalyNewHighVolume,
+					Bytes:       bytes,
+					HistoryDays: len(past),
+				})
+			}
+			continue
+		}
+
+		median := medianOf(series)
+		deviations := make([]float64, len(series))
+		for i, v := range series {
+			deviations[i] = math.Abs(v - median)
+		}
+		mad := medianOf(deviations)
+		// Flat series have a MAD of 0, any byte over the median would be flagged
+		if floor := median * 0.1; mad < floor {
+			mad = floor
+		}
+
+		threshold := median + opts.K*mad
+		if float64(bytes) <= threshold {
+			continue
+		}
+
+		score := 0.0
+		if mad > 0 {
+			score = (float64(bytes) - median) / mad
+		}
+		out = append(out, report.Anomaly{
+			Kind:           kind,
+			Key:            key,
+			Reason:         report.AnomalyAboveBaseline,
+			Bytes:          bytes,
+			BaselineBytes:  int(median),
+			MADBytes:       int(mad),
+			ThresholdBytes: int(threshold),
+			Score:          score,
+			HistoryDays:    len(past),
+		})
+	}
+	return out
+}
+
+func medianOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
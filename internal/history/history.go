@@ -0,0 +1,158 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"vpc_flowlogs_egress_analyzer/internal/report"
+)
+
+// Snapshot keeps the per-day aggregates anomaly detection needs, a few KB per day
+// instead of a full result.json
+type Snapshot struct {
+	Date         string         `json:"date"`
+	Region       string         `json:"region"`
+	Destinations map[string]int `json:"destinations"` // bytes per destination IP
+	Sources      map[string]int `json:"sources"`      // bytes per source IP
+}
+
+type Store struct {
+	dir     string
+	maxDays int
+}
+
+func NewStore(dir, region string, maxDays int) *Store {
+	return &Store{dir: filepath.Join(dir, region), maxDays: maxDays}
+}
+
+func SnapshotFromReport(r report.Report) Snapshot {
+	s := Snapshot{
+		Date:         r.Date(),
+		Region:       r.Region,
+		Destinations: make(map[string]int, len(r.EgressByIP)),
+		Sources:      make(map[string]int, len(r.EgressBySource)),
+	}
+	for _, e := range r.EgressByIP {
+		s.Destinations[e.IP] = e.Bytes
+	}
+	for _, e := range r.EgressBySource {
+		s.Sources[e.Source] = e.Bytes
+	}
+	return s
+}
+
+// Before returns the most recent snapshots strictly before date, oldest first
+func (s *Store) Before(date string) ([]Snapshot, error) {
+	dates, err := s.dates()
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []string
+	for _, d := range dates {
+		if d < date {
+			selected = append(selected, d)
+		}
+	}
+	if len(selected) > s.maxDays {
+		selected = selected[len(selected)-s.maxDays:]
+	}
+
+	snapshots := make([]Snapshot, 0, len(selected))
+	for _, d := range selected {
+		b, err := os.ReadFile(s.path(d))
+		if err != nil {
+			return nil, fmt.Errorf("read history %s: %w", d, err)
+		}
+		var snap Snapshot
+		if err := json.Unmarshal(b, &snap); err != nil {
+			return nil, fmt.Errorf("json decode history %s: %w", d, err)
+		}
+		snapshots = append(snapshots, snap)
+	}
+	return snapshots, nil
+}
+
+// ErrOutsideWindow is returned by Save for a date older than the window kept
+var ErrOutsideWindow = errors.New("date is older than the history window")
+
+// Save stores snap, replacing a previous run for the same date, and drops days that fell
+// out of the window ending at the newest day. A date already out of the window is not
+// stored, so backfilling only keeps the days that count.
+func (s *Store) Save(snap Snapshot) error {
+	dates, err := s.dates()
+	if err != nil {
+		return err
+	}
+	newest := snap.Date
+	if len(dates) > 0 && dates[len(dates)-1] > newest {
+		newest = dates[len(dates)-1]
+	}
+	oldest, err := windowStart(newest, s.maxDays)
+	if err != nil {
+		return err
+	}
+	if snap.Date < oldest {
+		return fmt.Errorf("%w: %s is before %s", ErrOutsideWindow, snap.Date, oldest)
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("mkdir history: %w", err)
+	}
+
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("marshal history: %w", err)
+	}
+	if err := os.WriteFile(s.path(snap.Date), b, 0644); err != nil {
+		return fmt.Errorf("write history: %w", err)
+	}
+
+	for _, d := range dates {
+		if d >= oldest {
+			break
+		}
+		if err := os.Remove(s.path(d)); err != nil {
+			return fmt.Errorf("prune history: %w", err)
+		}
+	}
+	return nil
+}
+
+// windowStart is the oldest date kept: the maxDays days before newest, the baseline of
+// newest when it is analyzed again
+func windowStart(newest string, maxDays int) (string, error) {
+	t, err := time.Parse("2006-01-02", newest)
+	if err != nil {
+		return "", fmt.Errorf("history date %q: %w", newest, err)
+	}
+	return t.AddDate(0, 0, -maxDays).Format("2006-01-02"), nil
+}
+
+func (s *Store) path(date string) string {
+	return filepath.Join(s.dir, date+".json")
+}
+
+func (s *Store) dates() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read history dir: %w", err)
+	}
+
+	var dates []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			dates = append(dates, strings.TrimSuffix(e.Name(), ".json"))
+		}
+	}
+	sort.Strings(dates)
+	return dates, nil
+}
@@ -0,0 +1,197 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+	"vpc_flowlogs_egress_analyzer/internal/report"
+)
+
+func snapshotOn(date string, destBytes int) Snapshot {
+	return Snapshot{
+		Date:         date,
+		Region:       "eu-west-3",
+		Destinations: map[string]int{"8.8.8.8": destBytes},
+		Sources:      map[string]int{"10.0.0.1": destBytes},
+	}
+}
+
+func day(n int) string {
+	return time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, n).Format("2006-01-02")
+}
+
+func storedDates(t *testing.T, s *Store) []string {
+	t.Helper()
+	dates, err := s.dates()
+	if err != nil {
+		t.Fatalf("dates: %v", err)
+	}
+	return dates
+}
+
+func TestSavePrunesByDate(t *testing.T) {
+	s := NewStore(t.TempDir(), "eu-west-3", 3)
+
+	for i := 0; i < 6; i++ {
+		if err := s.Save(snapshotOn(day(i), 100)); err != nil {
+			t.Fatalf("save %s: %v", day(i), err)
+		}
+	}
+	// The newest day and the 3 days of its baseline
+	if got, want := storedDates(t, s), []string{day(2), day(3), day(4), day(5)}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("stored %v, expected %v", got, want)
+	}
+
+	// A gap in the runs drops every day out of the window, not just the oldest
+	if err := s.Save(snapshotOn(day(8), 100)); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if got, want := storedDates(t, s), []string{day(5), day(8)}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("stored %v, expected %v", got, want)
+	}
+}
+
+func TestSaveBackfill(t *testing.T) {
+	s := NewStore(t.TempDir(), "eu-west-3", 3)
+
+	if err := s.Save(snapshotOn(day(10), 100)); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	// Older days within the window are kept when backfilled
+	for _, i := range []int{9, 7, 8} {
+		if err := s.Save(snapshotOn(day(i), 100)); err != nil {
+			t.Fatalf("backfill %s: %v", day(i), err)
+		}
+	}
+	if got, want := storedDates(t, s), []string{day(7), day(8), day(9), day(10)}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("stored %v, expected %v", got, want)
+	}
+
+	err := s.Save(snapshotOn(day(6), 100))
+	if !errors.Is(err, ErrOutsideWindow) {
+		t.Fatalf("expected ErrOutsideWindow for a day before the window, got %v", err)
+	}
+	if got := storedDates(t, s); len(got) != 4 || got[0] != day(7) {
+		t.Fatalf("a refused backfill changed the history: %v", got)
+	}
+
+	// Saving a day again replaces it
+	if err := s.Save(snapshotOn(day(9), 999)); err != nil {
+		t.Fatalf("save again: %v", err)
+	}
+	past, err := s.Before(day(10))
+	if err != nil {
+		t.Fatalf("before: %v", err)
+	}
+	if len(past) != 3 || past[0].Date != day(7) || past[2].Destinations["8.8.8.8"] != 999 {
+		t.Fatalf("unexpected baseline %+v", past)
+	}
+}
+
+func TestBeforeLimitsToMaxDays(t *testing.T) {
+	s := NewStore(t.TempDir(), "eu-west-3", 2)
+	for i := 0; i < 3; i++ {
+		if err := s.Save(snapshotOn(day(i), 100)); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+
+	past, err := s.Before(day(2))
+	if err != nil {
+		t.Fatalf("before: %v", err)
+	}
+	if len(past) != 2 || past[0].Date != day(0) || past[1].Date != day(1) {
+		t.Fatalf("expected the 2 days before %s oldest first, got %+v", day(2), past)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	opts := DetectOptions{K: 3, MinHistoryDays: 3, MinBytes: 1000, NewMinBytes: 50000}
+
+	var past []Snapshot
+	for i, b := range []int{10000, 11000, 9000, 10500, 9500} {
+		past = append(past, snapshotOn(day(i), b))
+	}
+
+	cases := []struct {
+		name    string
+		current Snapshot
+		past    []Snapshot
+		want    []string // kind/key/reason
+	}{
+		{
+			name:    "within baseline",
+			current: snapshotOn(day(5), 11500),
+			past:    past,
+		},
+		{
+			name:    "above baseline",
+			current: snapshotOn(day(5), 40000),
+			past:    past,
+			// Equal bytes are ordered by key
+			want: []string{
+				report.AnomalySource + "/10.0.0.1/" + report.AnomalyAboveBaseline,
+				report.AnomalyDestination + "/8.8.8.8/" + report.AnomalyAboveBaseline,
+			},
+		},
+		{
+			name:    "not enough history",
+			current: snapshotOn(day(5), 40000),
+			past:    past[:2],
+		},
+		{
+			name: "new high volume",
+			current: Snapshot{Date: day(5),
+				Destinations: map[string]int{"8.8.8.8": 10000, "1.1.1.1": 60000, "9.9.9.9": 40000},
+				Sources:      map[string]int{"10.0.0.1": 10000}},
+			past: past,
+			want: []string{report.AnomalyDestination + "/1.1.1.1/" + report.AnomalyNewHighVolume},
+		},
+		{
+			name:    "below minimum volume",
+			current: snapshotOn(day(5), 900),
+			past:    []Snapshot{snapshotOn(day(0), 10), snapshotOn(day(1), 10), snapshotOn(day(2), 10)},
+		},
+		{
+			name:    "flat series is not flagged for a small increase",
+			current: snapshotOn(day(3), 10500),
+			past:    []Snapshot{snapshotOn(day(0), 10000), snapshotOn(day(1), 10000), snapshotOn(day(2), 10000)},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got []string
+			for _, a := range Detect(c.current, c.past, opts) {
+				got = append(got, fmt.Sprintf("%s/%s/%s", a.Kind, a.Key, a.Reason))
+			}
+			if len(got) != len(c.want) {
+				t.Fatalf("got %v, expected %v", got, c.want)
+			}
+			for i := range got {
+				if got[i] != c.want[i] {
+					t.Fatalf("got %v, expected %v", got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDetectAbsentDaysCountAsZero(t *testing.T) {
+	opts := DetectOptions{K: 3, MinHistoryDays: 3, MinBytes: 1000, NewMinBytes: 1 << 40}
+	past := []Snapshot{
+		snapshotOn(day(0), 5000),
+		{Date: day(1), Destinations: map[string]int{}, Sources: map[string]int{}},
+		{Date: day(2), Destinations: map[string]int{}, Sources: map[string]int{}},
+	}
+
+	anomalies := Detect(snapshotOn(day(3), 5000), past, opts)
+	if len(anomalies) != 2 {
+		t.Fatalf("expected both entities above a zero median, got %+v", anomalies)
+	}
+	if a := anomalies[0]; a.BaselineBytes != 0 || a.HistoryDays != 3 {
+		t.Fatalf("unexpected baseline %+v", a)
+	}
+}
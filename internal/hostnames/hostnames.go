@@ -0,0 +1,78 @@
+package hostnames
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"vpc_flowlogs_egress_analyzer/internal/cache"
+	"vpc_flowlogs_egress_analyzer/internal/config"
+)
+
+const (
+	SourceQueryLog = "route53_query_log"
+	SourcePTR      = "ptr"
+)
+
+// Target is a destination IP with the time range it was seen in flow logs (unix seconds)
+type Target struct {
+	IP        string
+	FirstSeen int64
+	LastSeen  int64
+}
+
+type Result struct {
+	Hostname   string   `json:"hostname"`
+	Source     string   `json:"source"`
+	QueryNames []string `json:"query_names,omitempty"`
+	PTR        string   `json:"ptr,omitempty"`
+}
+
+func Enabled() bool {
+	return config.GetEnv("HOSTNAME_LOOKUP") == "true"
+}
+
+// Resolve attributes hostnames to targets. Names resolved by our own workloads, found in
+// Route 53 Resolver query logs, are preferred over PTR records which often only
+// name the hosting provider. PTR answers are cached in store.
+func Resolve(store cache.Cache, targets []Target) map[string]Result {
+	results := make(map[string]Result, len(targets))
+
+	if paths := config.GetEnv("ROUTE53_QUERY_LOGS"); paths != "" {
+		window := int64(config.GetEnvInt("ROUTE53_QUERY_LOG_WINDOW_SECONDS"))
+		matches := matchQueryLogs(strings.Split(paths, ","), targets, window)
+		for ip, names := range matches {
+			results[ip] = Result{Hostname: names[0], Source: SourceQueryLog, QueryNames: names}
+		}
+		fmt.Printf("🔗 Matched %d destinations with Route 53 query logs\n", len(matches))
+	}
+
+	ptrs := lookupPTRs(store, targets, config.GetEnv("DNS_RESOLVER"))
+	for ip, ptr := range ptrs {
+		if ptr == "" {
+			continue
+		}
+		if r, exists := results[ip]; exists {
+			r.PTR = ptr
+			results[ip] = r
+			continue
+		}
+		results[ip] = Result{Hostname: ptr, Source: SourcePTR, PTR: ptr}
+	}
+
+	return results
+}
+
+// rankNames orders names by hit count, then alphabetically
+func rankNames(hits map[string]int) []string {
+	names := make([]string, 0, len(hits))
+	for n := range hits {
+		names = append(names, n)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if hits[names[i]] != hits[names[j]] {
+			return hits[names[i]] > hits[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
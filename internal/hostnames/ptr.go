@@ -0,0 +1,105 @@
+package hostnames
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"vpc_flowlogs_egress_analyzer/internal/cache"
+)
+
+const (
+	ptrCacheKey = "hostnames-ptr"
+	ptrCacheTTL = 7 * 24 * time.Hour
+	ptrTimeout  = 3 * time.Second
+	ptrWorkers  = 8
+)
+
+type ptrCacheEntry struct {
+	Hostname   string `json:"hostname"`
+	ResolvedAt int64  `json:"resolved_at"`
+}
+
+func newResolver(addr string) *net.Resolver {
+	if addr == "" {
+		return net.DefaultResolver
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			d := net.Dialer{Timeout: ptrTimeout}
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// lookupPTRs reverse-resolves targets, reusing cached answers (negative ones included)
+func lookupPTRs(store cache.Cache, targets []Target, resolverAddr string) map[string]string {
+	cached := map[string]ptrCacheEntry{}
+	c, err := cache.Load[map[string]ptrCacheEntry](context.TODO(), store, ptrCacheKey, cache.JSON)
+	if err == nil {
+		cached = c
+	} else if !errors.Is(err, cache.ErrNotFound) {
+		fmt.Printf("⚠️ Warning: ignoring PTR cache: %v\n", err)
+	}
+
+	now := time.Now()
+	results := make(map[string]string, len(targets))
+	var pending []string
+	for _, t := range targets {
+		if e, ok := cached[t.IP]; ok && now.Sub(time.Unix(e.ResolvedAt, 0)) < ptrCacheTTL {
+			results[t.IP] = e.Hostname
+			continue
+		}
+		pending = append(pending, t.IP)
+	}
+
+	fmt.Printf("🔁 Reverse DNS: %d cached, %d to resolve\n", len(results), len(pending))
+	if len(pending) == 0 {
+		return results
+	}
+
+	resolver := newResolver(resolverAddr)
+	jobs := make(chan string, len(pending))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for w := 0; w < ptrWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := range jobs {
+				ctx, cancel := context.WithTimeout(context.Background(), ptrTimeout)
+				names, err := resolver.LookupAddr(ctx, ip)
+				cancel()
+
+				hostname := ""
+				if err == nil && len(names) > 0 {
+					hostname = strings.TrimSuffix(names[0], ".")
+				}
+
+				mu.Lock()
+				results[ip] = hostname
+				cached[ip] = ptrCacheEntry{Hostname: hostname, ResolvedAt: now.Unix()}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, ip := range pending {
+		jobs <- ip
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := cache.Save(context.TODO(), store, ptrCacheKey, cached); err != nil {
+		fmt.Printf("⚠️ Warning: failed to save PTR cache: %v\n", err)
+	}
+	return results
+}
@@ -0,0 +1,121 @@
+package hostnames
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// queryLogRecord is the subset of a Route 53 Resolver query log entry we need
+type queryLogRecord struct {
+	QueryTimestamp string `json:"query_timestamp"`
+	QueryName      string `json:"query_name"`
+	Answers        []struct {
+		Rdata string `json:"Rdata"`
+		Type  string `json:"Type"`
+	} `json:"answers"`
+}
+
+// matchQueryLogs returns, for each target IP, the query names whose answers contained
+// that IP within `window` seconds before or during the time it was seen in flow logs.
+// Unreadable paths and files are skipped with a warning, keeping the matches of the others
+// and the records read before a file failed.
+func matchQueryLogs(paths []string, targets []Target, window int64) map[string][]string {
+	byIP := make(map[string]Target, len(targets))
+	for _, t := range targets {
+		byIP[t.IP] = t
+	}
+
+	hits := make(map[string]map[string]int)
+	visit := func(file string) error {
+		return scanQueryLog(file, func(rec queryLogRecord) {
+			ts, err := time.Parse(time.RFC3339, rec.QueryTimestamp)
+			if err != nil {
+				return
+			}
+			name := strings.TrimSuffix(rec.QueryName, ".")
+			for _, a := range rec.Answers {
+				if a.Type != "A" && a.Type != "AAAA" {
+					continue
+				}
+				t, ok := byIP[a.Rdata]
+				if !ok {
+					continue
+				}
+				if ts.Unix() < t.FirstSeen-window || ts.Unix() > t.LastSeen {
+					continue
+				}
+				if hits[a.Rdata] == nil {
+					hits[a.Rdata] = make(map[string]int)
+				}
+				hits[a.Rdata][name]++
+			}
+		})
+	}
+
+	for _, p := range paths {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		filepath.WalkDir(p, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				fmt.Printf("⚠️ Warning: skipping Route 53 query logs in %s: %v\n", file, err)
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			if err := visit(file); err != nil {
+				fmt.Printf("⚠️ Warning: skipping the rest of a Route 53 query log: %v\n", err)
+			}
+			return nil
+		})
+	}
+
+	matches := make(map[string][]string, len(hits))
+	for ip, names := range hits {
+		matches[ip] = rankNames(names)
+	}
+	return matches
+}
+
+// scanQueryLog reads newline-delimited JSON, gzipped or not, as delivered to S3 or CloudWatch exports
+func scanQueryLog(file string, fn func(queryLogRecord)) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("open query log: %w", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(file, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("gzip reader %s: %w", file, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec queryLogRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		fn(rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read query log %s: %w", file, err)
+	}
+	return nil
+}
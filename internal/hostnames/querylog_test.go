@@ -0,0 +1,58 @@
+package hostnames
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func queryLogLine(ts, name, ip string) string {
+	return fmt.Sprintf(`{"query_timestamp":%q,"query_name":%q,"answers":[{"Rdata":%q,"Type":"A"}]}`+"\n", ts, name, ip)
+}
+
+func TestMatchQueryLogsKeepsPartialMatches(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	write("a.log", []byte(
+		queryLogLine("2025-12-02T10:00:00Z", "api.example.com.", "8.8.8.8")+
+			queryLogLine("2025-12-02T10:00:01Z", "api.example.com.", "8.8.8.8")+
+			queryLogLine("2025-12-02T10:00:02Z", "cdn.example.com.", "8.8.8.8")+
+			"not json\n"+
+			queryLogLine("2025-12-03T10:00:00Z", "late.example.com.", "8.8.8.8")))
+
+	// A gzip cut short: the records before the cut still count
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	for i := 0; i < 200; i++ {
+		fmt.Fprint(w, queryLogLine("2025-12-02T11:00:00Z", "sts.amazonaws.com.", "52.94.0.1"))
+	}
+	w.Close()
+	write("b.log.gz", gz.Bytes()[:gz.Len()-10])
+	write("c.log.gz", []byte("not gzip"))
+
+	start := int64(1764669600) // 2025-12-02T10:00:00Z
+	targets := []Target{
+		{IP: "8.8.8.8", FirstSeen: start, LastSeen: start + 3600},
+		{IP: "52.94.0.1", FirstSeen: start, LastSeen: start + 7200},
+		{IP: "1.1.1.1", FirstSeen: start, LastSeen: start + 3600},
+	}
+
+	got := matchQueryLogs([]string{filepath.Join(dir, "missing"), " " + dir + " ", ""}, targets, 300)
+	want := map[string][]string{
+		"8.8.8.8":   {"api.example.com", "cdn.example.com"},
+		"52.94.0.1": {"sts.amazonaws.com"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, expected %v", got, want)
+	}
+}
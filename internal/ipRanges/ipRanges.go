@@ -0,0 +1,225 @@
+package ipRanges
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"vpc_flowlogs_egress_analyzer/internal/config"
+)
+
+const PublishedURL = "https://ip-ranges.amazonaws.com/ip-ranges.json"
+
+// Generic service tag covering every other service prefix
+const genericService = "AMAZON"
+
+type ipRangesFile struct {
+	SyncToken  string `json:"syncToken"`
+	CreateDate string `json:"createDate"`
+	Prefixes   []struct {
+		IPPrefix string `json:"ip_prefix"`
+		Region   string `json:"region"`
+		Service  string `json:"service"`
+	} `json:"prefixes"`
+	IPv6Prefixes []struct {
+		IPv6Prefix string `json:"ipv6_prefix"`
+		Region     string `json:"region"`
+		Service    string `json:"service"`
+	} `json:"ipv6_prefixes"`
+}
+
+type rangeEntry struct {
+	Region   string
+	Services []string
+}
+
+type Ranges struct {
+	CreateDate string
+	byPrefix   map[netip.Prefix]*rangeEntry
+	v4Bits     []int
+	v6Bits     []int
+}
+
+type Match struct {
+	Prefix  string `json:"prefix"`
+	Service string `json:"service"`
+	Region  string `json:"region"`
+}
+
+var (
+	defaultRanges  *Ranges
+	loadRangesOnce sync.Once
+)
+
+func FilePath() string {
+	return config.GetEnv("AWS_IP_RANGES_FILE")
+}
+
+// Get returns the ranges loaded from AWS_IP_RANGES_FILE, or nil when the file is unavailable
+func Get() *Ranges {
+	loadRangesOnce.Do(func() {
+		r, err := Load(FilePath())
+		if err != nil {
+			fmt.Printf("⚠️ AWS IP ranges not loaded (%v). Run `make ip-ranges` to download them.\n", err)
+			return
+		}
+		fmt.Printf("🗺️ Loaded %d AWS IP prefixes (published %s)\n", len(r.byPrefix), r.CreateDate)
+		defaultRanges = r
+	})
+	return defaultRanges
+}
+
+func Load(path string) (*Ranges, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open ip ranges: %w", err)
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+func Parse(rd io.Reader) (*Ranges, error) {
+	var raw ipRangesFile
+	if err := json.NewDecoder(rd).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("json decode ip ranges: %w", err)
+	}
+
+	r := &Ranges{
+		CreateDate: raw.CreateDate,
+		byPrefix:   make(map[netip.Prefix]*rangeEntry),
+	}
+	for _, p := range raw.Prefixes {
+		r.add(p.IPPrefix, p.Region, p.Service)
+	}
+	for _, p := range raw.IPv6Prefixes {
+		r.add(p.IPv6Prefix, p.Region, p.Service)
+	}
+
+	v4, v6 := map[int]bool{}, map[int]bool{}
+	for p := range r.byPrefix {
+		if p.Addr().Is4() {
+			v4[p.Bits()] = true
+		} else {
+			v6[p.Bits()] = true
+		}
+	}
+	r.v4Bits = sortedDesc(v4)
+	r.v6Bits = sortedDesc(v6)
+
+	return r, nil
+}
+
+func (r *Ranges) add(cidr, region, service string) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return
+	}
+	prefix = prefix.Masked()
+
+	entry, exists := r.byPrefix[prefix]
+	if !exists {
+		entry = &rangeEntry{Region: region}
+		r.byPrefix[prefix] = entry
+	}
+	for _, s := range entry.Services {
+		if s == service {
+			return
+		}
+	}
+	entry.Services = append(entry.Services, service)
+}
+
+// Lookup finds the most specific prefix containing ip. AWS lists every prefix under
+// AMAZON as well, so a specific service from a wider prefix wins over the generic tag, and
+// the match then takes the prefix and region of that service.
+func (r *Ranges) Lookup(ip string) (Match, bool) {
+	if r == nil {
+		return Match{}, false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Match{}, false
+	}
+	addr = addr.Unmap()
+
+	bits := r.v6Bits
+	if addr.Is4() {
+		bits = r.v4Bits
+	}
+
+	var match Match
+	found := false
+	for _, b := range bits {
+		prefix, err := addr.Prefix(b)
+		if err != nil {
+			continue
+		}
+		entry, ok := r.byPrefix[prefix]
+		if !ok {
+			continue
+		}
+		if !found {
+			match = Match{Prefix: prefix.String(), Service: genericService, Region: entry.Region}
+			found = true
+		}
+		for _, s := range entry.Services {
+			if s != genericService {
+				return Match{Prefix: prefix.String(), Service: s, Region: entry.Region}, true
+			}
+		}
+	}
+	return match, found
+}
+
+// Update downloads the published ip-ranges.json to path
+func Update(path string) error {
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(PublishedURL)
+	if err != nil {
+		return fmt.Errorf("download ip ranges: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("download ip ranges: http %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read ip ranges: %w", err)
+	}
+
+	r, err := Parse(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("mkdir ip ranges: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, body, 0644); err != nil {
+		return fmt.Errorf("write ip ranges: %w", err)
+	}
+
+	fmt.Printf("🗺️ Saved %d AWS IP prefixes (published %s) to %s\n", len(r.byPrefix), r.CreateDate, path)
+	return nil
+}
+
+func sortedDesc(set map[int]bool) []int {
+	out := make([]int, 0, len(set))
+	for b := range set {
+		out = append(out, b)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(out)))
+	return out
+}
@@ -0,0 +1,59 @@
+package ipRanges
+
+import (
+	"strings"
+	"testing"
+)
+
+const testRanges = `{
+  "syncToken": "1",
+  "createDate": "2025-12-01-00-00-00",
+  "prefixes": [
+    {"ip_prefix": "52.94.0.0/16", "region": "us-east-1", "service": "AMAZON"},
+    {"ip_prefix": "52.94.0.0/16", "region": "us-east-1", "service": "DYNAMODB"},
+    {"ip_prefix": "52.94.5.0/24", "region": "eu-west-3", "service": "AMAZON"},
+    {"ip_prefix": "3.5.0.0/16", "region": "eu-west-3", "service": "AMAZON"},
+    {"ip_prefix": "3.5.1.0/24", "region": "eu-west-3", "service": "AMAZON"},
+    {"ip_prefix": "3.5.1.0/24", "region": "eu-west-3", "service": "S3"},
+    {"ip_prefix": "invalid", "region": "eu-west-3", "service": "S3"}
+  ],
+  "ipv6_prefixes": [
+    {"ipv6_prefix": "2600:1f00::/24", "region": "GLOBAL", "service": "AMAZON"},
+    {"ipv6_prefix": "2600:1f18::/36", "region": "us-east-1", "service": "EC2"}
+  ]
+}`
+
+func TestLookup(t *testing.T) {
+	r, err := Parse(strings.NewReader(testRanges))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	cases := []struct {
+		ip    string
+		match Match
+		found bool
+	}{
+		// The service, its prefix and region come from the same entry, not the narrower AMAZON one
+		{"52.94.5.10", Match{Prefix: "52.94.0.0/16", Service: "DYNAMODB", Region: "us-east-1"}, true},
+		{"52.94.6.10", Match{Prefix: "52.94.0.0/16", Service: "DYNAMODB", Region: "us-east-1"}, true},
+		{"3.5.1.20", Match{Prefix: "3.5.1.0/24", Service: "S3", Region: "eu-west-3"}, true},
+		{"3.5.2.20", Match{Prefix: "3.5.0.0/16", Service: "AMAZON", Region: "eu-west-3"}, true},
+		{"::ffff:3.5.1.20", Match{Prefix: "3.5.1.0/24", Service: "S3", Region: "eu-west-3"}, true},
+		{"2600:1f18::1", Match{Prefix: "2600:1f18::/36", Service: "EC2", Region: "us-east-1"}, true},
+		{"2600:1f01::1", Match{Prefix: "2600:1f00::/24", Service: "AMAZON", Region: "GLOBAL"}, true},
+		{"8.8.8.8", Match{}, false},
+		{"not an ip", Match{}, false},
+	}
+	for _, c := range cases {
+		match, found := r.Lookup(c.ip)
+		if found != c.found || match != c.match {
+			t.Errorf("Lookup(%q) = %+v, %t, expected %+v, %t", c.ip, match, found, c.match, c.found)
+		}
+	}
+
+	var nilRanges *Ranges
+	if _, found := nilRanges.Lookup("3.5.1.20"); found {
+		t.Errorf("nil ranges matched")
+	}
+}
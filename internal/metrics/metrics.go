@@ -0,0 +1,197 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"vpc_flowlogs_egress_analyzer/internal/report"
+)
+
+// Label value of the bucket summing every series beyond the top N
+const otherLabel = "other"
+
+type series struct {
+	labels  []string // name, value pairs
+	bytes   float64
+	costUSD float64
+}
+
+type family struct {
+	name   string
+	help   string
+	series []sample
+}
+
+type sample struct {
+	labels []string
+	value  float64
+}
+
+// Write renders the report in OpenMetrics text format, compatible with the
+// node_exporter textfile collector. Per-entity metrics keep the topN biggest series
+// and sum the rest into an "other" series.
+func Write(w io.Writer, r report.Report, topN int) error {
+	region := []string{"region", r.Region}
+
+	var families []family
+
+	families = append(families,
+		family{name: "vpc_egress_analysis_info", help: "Analyzed day and region.", series: []sample{{labels: []string{"region", r.Region, "date", r.Date()}, value: 1}}},
+		family{name: "vpc_egress_total_bytes", help: "Bytes sent to the internet through NAT.", series: []sample{{labels: region, value: float64(r.Total.Bytes)}}},
+		family{name: "vpc_egress_total_cost_usd", help: "Estimated NAT data processing cost.", series: []sample{{labels: region, value: r.Total.CostUSD}}},
+	)
+
+	pairs := make(map[string]*series)
+	for _, p := range r.EgressByPair {
+		labels := []string{"destination", p.Destination, "aws_service", p.AwsService, "source_eni", p.InterfaceID}
+		key := strings.Join(labels, "\x00")
+		if _, ok := pairs[key]; !ok {
+			pairs[key] = &series{labels: labels}
+		}
+		pairs[key].bytes += float64(p.Bytes)
+		pairs[key].costUSD += p.CostUSD
+	}
+	// EgressByPair is itself cut to PAIR_TOP_N, so "other" comes from the total for the
+	// series to add up to vpc_egress_total_bytes
+	total := &series{bytes: float64(r.Total.Bytes), costUSD: r.Total.CostUSD}
+	bytes, cost := split(pairs, topN, []string{"destination", "aws_service", "source_eni"}, region, total)
+	families = append(families,
+		family{name: "vpc_egress_bytes", help: "Bytes sent through NAT by destination, AWS service and source ENI.", series: bytes},
+		family{name: "vpc_egress_cost_usd", help: "Estimated NAT cost by destination, AWS service and source ENI.", series: cost},
+	)
+
+	services := make(map[string]*series)
+	for _, s := range r.EgressByAwsService {
+		labels := []string{"aws_service", s.Service, "aws_region", s.Region, "cross_region", strconv.FormatBool(s.CrossRegion)}
+		services[strings.Join(labels, "\x00")] = &series{labels: labels, bytes: float64(s.Bytes), costUSD: s.CostUSD}
+	}
+	bytes, cost = split(services, topN, []string{"aws_service", "aws_region", "cross_region"}, region, nil)
+	families = append(families,
+		family{name: "vpc_egress_aws_service_bytes", help: "Bytes sent to AWS services through NAT.", series: bytes},
+		family{name: "vpc_egress_aws_service_cost_usd", help: "Estimated NAT cost of AWS service traffic.", series: cost},
+	)
+
+	savings := family{name: "vpc_egress_endpoint_savings_usd_monthly", help: "Estimated monthly net savings of the recommended VPC endpoint."}
+	for _, rec := range r.Recommendations {
+		if rec.NetSavingsMonthlyUSD == 0 {
+			continue
+		}
+		savings.series = append(savings.series, sample{labels: append([]string{"aws_service", rec.Service, "endpoint_type", rec.EndpointType}, region...), value: rec.NetSavingsMonthlyUSD})
+	}
+	families = append(families, savings)
+
+	violations := map[string]float64{report.BudgetWarning: 0, report.BudgetCritical: 0}
+	for _, v := range r.BudgetViolations {
+		violations[v.Level]++
+	}
+	families = append(families,
+		family{name: "vpc_egress_budget_violations", help: "Exceeded budgets by level.", series: []sample{
+			{labels: append([]string{"level", report.BudgetWarning}, region...), value: violations[report.BudgetWarning]},
+			{labels: append([]string{"level", report.BudgetCritical}, region...), value: violations[report.BudgetCritical]},
+		}},
+		family{name: "vpc_egress_anomalies", help: "Entities flagged above their baseline or new with high volume.", series: []sample{{labels: region, value: float64(len(r.Anomalies))}}},
+	)
+
+	var b strings.Builder
+	for _, f := range families {
+		fmt.Fprintf(&b, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", f.name)
+		for _, s := range f.series {
+			fmt.Fprintf(&b, "%s{%s} %s\n", f.name, formatLabels(s.labels), strconv.FormatFloat(s.value, 'g', -1, 64))
+		}
+	}
+	b.WriteString("# EOF\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteFile writes atomically so the textfile collector never reads a partial file
+func WriteFile(path string, r report.Report, topN int) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create metrics file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := Write(tmp, r, topN); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close metrics file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("chmod metrics file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename metrics file: %w", err)
+	}
+	return nil
+}
+
+// split sorts series by bytes, keeps topN and folds the rest into one "other" series. When
+// total is set, "other" is what total has beyond the kept series, including series missing
+// from all, otherwise total is the sum of all.
+func split(all map[string]*series, topN int, labelNames []string, extra []string, total *series) (bytes, cost []sample) {
+	list := make([]*series, 0, len(all))
+	for _, s := range all {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].bytes != list[j].bytes {
+			return list[i].bytes > list[j].bytes
+		}
+		return strings.Join(list[i].labels, ",") < strings.Join(list[j].labels, ",")
+	})
+
+	if total == nil {
+		total = &series{}
+		for _, s := range list {
+			total.bytes += s.bytes
+			total.costUSD += s.costUSD
+		}
+	}
+
+	truncated := topN > 0 && len(list) > topN
+	if truncated {
+		list = list[:topN]
+	}
+
+	other := &series{bytes: total.bytes, costUSD: total.costUSD}
+	for _, s := range list {
+		other.bytes -= s.bytes
+		other.costUSD -= s.costUSD
+	}
+	if truncated || other.bytes > 0 {
+		for _, name := range labelNames {
+			other.labels = append(other.labels, name, otherLabel)
+		}
+		list = append(list, other)
+	}
+
+	for _, s := range list {
+		labels := append(append([]string{}, s.labels...), extra...)
+		bytes = append(bytes, sample{labels: labels, value: s.bytes})
+		cost = append(cost, sample{labels: labels, value: s.costUSD})
+	}
+	return bytes, cost
+}
+
+func formatLabels(pairs []string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=\"%s\"", pairs[i], escapeLabel(pairs[i+1])))
+	}
+	return strings.Join(parts, ",")
+}
+
+func escapeLabel(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return strings.ReplaceAll(v, "\n", `\n`)
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+	"vpc_flowlogs_egress_analyzer/internal/report"
+)
+
+const contentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Server exposes the latest report on /metrics while refresh runs in the background
+type Server struct {
+	topN int
+
+	mu     sync.RWMutex
+	latest *report.Report
+	at     time.Time
+}
+
+func NewServer(topN int) *Server {
+	return &Server{topN: topN}
+}
+
+func (s *Server) Set(r report.Report) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latest = &r
+	s.at = time.Now()
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	s.mu.RLock()
+	latest, at := s.latest, s.at
+	s.mu.RUnlock()
+
+	if latest == nil {
+		http.Error(w, "no analysis available yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, *latest, s.topN); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Last-Modified", at.UTC().Format(http.TimeFormat))
+	w.Write(buf.Bytes())
+}
+
+// Run refreshes the report every interval and serves it on addr until the server fails
+func (s *Server) Run(addr string, interval time.Duration, refresh func() (report.Report, error)) error {
+	go func() {
+		for {
+			r, err := refresh()
+			if err != nil {
+				log.Printf("❌ Refresh failed: %v", err)
+			} else {
+				s.Set(r)
+			}
+			time.Sleep(interval)
+		}
+	}()
+
+	fmt.Printf("📡 Serving metrics on %s/metrics, refreshing every %s\n", addr, interval)
+	return http.ListenAndServe(addr, s.Handler())
+}
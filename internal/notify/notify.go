@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+	"vpc_flowlogs_egress_analyzer/internal/config"
+	"vpc_flowlogs_egress_analyzer/internal/report"
+)
+
+const (
+	requestTimeout = 10 * time.Second
+	baseBackoff    = 500 * time.Millisecond
+	maxBackoff     = 30 * time.Second
+)
+
+func Enabled() bool {
+	return config.GetEnv("WEBHOOK_URL") != "" || config.GetEnv("WEBHOOK_DRY_RUN") == "true"
+}
+
+// Send posts the report summary to WEBHOOK_URL, or prints the payload with WEBHOOK_DRY_RUN
+func Send(r report.Report) error {
+	payload, err := Payload(config.GetEnv("WEBHOOK_FORMAT"), Summarize(r))
+	if err != nil {
+		return err
+	}
+	body, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal webhook payload: %w", err)
+	}
+
+	if config.GetEnv("WEBHOOK_DRY_RUN") == "true" {
+		fmt.Println("📨 Webhook dry run, payload:")
+		fmt.Println(string(body))
+		return nil
+	}
+
+	url := config.GetEnv("WEBHOOK_URL")
+	if err := post(url, body, config.GetEnvInt("WEBHOOK_MAX_RETRIES")); err != nil {
+		return err
+	}
+	fmt.Println("📨 Webhook notification sent")
+	return nil
+}
+
+// post retries network errors, 429 and 5xx responses with exponential backoff and full
+// jitter, honoring Retry-After when the server sends one
+func post(url string, body []byte, maxRetries int) error {
+	client := http.Client{Timeout: requestTimeout}
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			wait := backoff(attempt)
+			if ra, ok := lastErr.(retryAfterError); ok && ra.after > 0 {
+				wait = ra.after
+			}
+			fmt.Printf("⏳ Webhook attempt %d failed (%v), retrying in %s\n", attempt, lastErr, wait.Round(time.Millisecond))
+			time.Sleep(wait)
+		}
+
+		resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+
+		if resp.StatusCode < 300 {
+			return nil
+		}
+
+		err = fmt.Errorf("webhook http %d: %s", resp.StatusCode, bytes.TrimSpace(respBody))
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			return err
+		}
+		lastErr = retryAfterError{error: err, after: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+	return fmt.Errorf("webhook failed after %d attempts: %w", maxRetries+1, lastErr)
+}
+
+type retryAfterError struct {
+	error
+	after time.Duration
+}
+
+func (e retryAfterError) Unwrap() error {
+	return e.error
+}
+
+func backoff(attempt int) time.Duration {
+	d := baseBackoff << (attempt - 1)
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
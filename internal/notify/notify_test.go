@@ -0,0 +1,202 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"vpc_flowlogs_egress_analyzer/internal/report"
+)
+
+func testReport(violations int) report.Report {
+	r := report.Report{
+		Year: "2025", Month: "12", Day: "02", Region: "eu-west-3",
+		Total: report.Total{Bytes: 1 << 30, GB: 1, CostUSD: 0.062},
+		EgressByIP: []report.IPEntry{
+			{IP: "8.8.8.8", GB: 0.6, CostUSD: 0.04},
+			{IP: "52.94.0.1", AwsService: "DYNAMODB", GB: 0.4, CostUSD: 0.02},
+		},
+	}
+	for i := 0; i < violations; i++ {
+		level := report.BudgetWarning
+		if i%10 == 0 {
+			level = report.BudgetCritical
+		}
+		r.BudgetViolations = append(r.BudgetViolations, report.BudgetViolation{
+			Budget:    "per-destination-gb",
+			Key:       fmt.Sprintf("10.0.%d.%d-with-a-rather-long-destination-name.example.com", i/250, i%250),
+			Level:     level,
+			Value:     float64(100 + i),
+			Threshold: 50,
+			Unit:      "GB",
+		})
+	}
+	return r
+}
+
+// webhookServer records the bodies it receives and answers with the given statuses in order,
+// then 200
+type webhookServer struct {
+	mu       sync.Mutex
+	statuses []int
+	bodies   [][]byte
+}
+
+func (s *webhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bodies = append(s.bodies, body)
+	if len(s.statuses) > 0 {
+		status := s.statuses[0]
+		s.statuses = s.statuses[1:]
+		http.Error(w, http.StatusText(status), status)
+	}
+}
+
+func send(t *testing.T, format string, r report.Report) map[string]any {
+	t.Helper()
+	ws := &webhookServer{}
+	srv := httptest.NewServer(ws)
+	defer srv.Close()
+
+	t.Setenv("WEBHOOK_URL", srv.URL)
+	t.Setenv("WEBHOOK_FORMAT", format)
+	if err := Send(r); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if len(ws.bodies) != 1 {
+		t.Fatalf("webhook received %d requests, expected 1", len(ws.bodies))
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(ws.bodies[0], &payload); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	return payload
+}
+
+func TestSlackPayload(t *testing.T) {
+	payload := send(t, FormatSlack, testReport(200))
+
+	if text, _ := payload["text"].(string); !strings.Contains(text, "2025-12-02") {
+		t.Fatalf("fallback text %q misses the date", text)
+	}
+	blocks, _ := payload["blocks"].([]any)
+	if len(blocks) < 3 {
+		t.Fatalf("expected header, fields and sections, got %d blocks", len(blocks))
+	}
+
+	var violations string
+	for _, b := range blocks {
+		block := b.(map[string]any)
+		text, ok := block["text"].(map[string]any)
+		if !ok || block["type"] != "section" {
+			continue
+		}
+		content := text["text"].(string)
+		if n := len([]rune(content)); n > slackSectionLimit {
+			t.Fatalf("section has %d characters, Slack accepts %d", n, slackSectionLimit)
+		}
+		if strings.Contains(content, "Budget violations") {
+			violations = content
+		}
+	}
+	if got := strings.Count(violations, "\n"); got != topViolations+1 {
+		t.Fatalf("violations section has %d lines, expected heading, %d violations and a remainder:\n%s", got+1, topViolations, violations)
+	}
+	if !strings.Contains(violations, "…and 195 more") || !strings.HasPrefix(strings.Split(violations, "\n")[1], "🛑") {
+		t.Fatalf("expected critical violations first and a remainder line:\n%s", violations)
+	}
+}
+
+func TestTeamsPayload(t *testing.T) {
+	payload := send(t, FormatTeams, testReport(12))
+
+	if payload["type"] != "message" {
+		t.Fatalf("type is %v, expected message", payload["type"])
+	}
+	attachments, _ := payload["attachments"].([]any)
+	if len(attachments) != 1 {
+		t.Fatalf("expected one attachment, got %d", len(attachments))
+	}
+	attachment := attachments[0].(map[string]any)
+	if attachment["contentType"] != "application/vnd.microsoft.card.adaptive" {
+		t.Fatalf("content type is %v", attachment["contentType"])
+	}
+	card := attachment["content"].(map[string]any)
+	if card["type"] != "AdaptiveCard" {
+		t.Fatalf("card type is %v", card["type"])
+	}
+
+	var found bool
+	for _, b := range card["body"].([]any) {
+		if text, _ := b.(map[string]any)["text"].(string); strings.Contains(text, "…and 7 more") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("card misses the remaining violations line: %v", card["body"])
+	}
+}
+
+func TestJSONPayload(t *testing.T) {
+	payload := send(t, FormatJSON, testReport(8))
+
+	if payload["date"] != "2025-12-02" || payload["region"] != "eu-west-3" {
+		t.Fatalf("unexpected date or region: %v", payload)
+	}
+	if got := len(payload["budget_violations"].([]any)); got != topViolations {
+		t.Fatalf("%d budget violations, expected %d", got, topViolations)
+	}
+	if payload["more_budget_violations"] != float64(3) {
+		t.Fatalf("more_budget_violations is %v, expected 3", payload["more_budget_violations"])
+	}
+	if got := len(payload["top_destinations"].([]any)); got != 2 {
+		t.Fatalf("%d top destinations, expected 2", got)
+	}
+}
+
+func TestPostRetriesServerErrors(t *testing.T) {
+	ws := &webhookServer{statuses: []int{http.StatusInternalServerError, http.StatusBadGateway}}
+	srv := httptest.NewServer(ws)
+	defer srv.Close()
+
+	if err := post(srv.URL, []byte("{}"), 3); err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	if len(ws.bodies) != 3 {
+		t.Fatalf("webhook received %d requests, expected 2 failures and a success", len(ws.bodies))
+	}
+}
+
+func TestPostGivesUp(t *testing.T) {
+	ws := &webhookServer{statuses: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(ws)
+	defer srv.Close()
+
+	if err := post(srv.URL, []byte("{}"), 1); err == nil {
+		t.Fatalf("post succeeded after exhausting its retries")
+	}
+	if len(ws.bodies) != 2 {
+		t.Fatalf("webhook received %d requests, expected 2", len(ws.bodies))
+	}
+}
+
+func TestPostDoesNotRetryClientErrors(t *testing.T) {
+	ws := &webhookServer{statuses: []int{http.StatusBadRequest}}
+	srv := httptest.NewServer(ws)
+	defer srv.Close()
+
+	if err := post(srv.URL, []byte("{}"), 3); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Fatalf("expected the 400 error, got %v", err)
+	}
+	if len(ws.bodies) != 1 {
+		t.Fatalf("webhook received %d requests, a 400 must not be retried", len(ws.bodies))
+	}
+}
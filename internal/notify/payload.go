@@ -0,0 +1,153 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"vpc_flowlogs_egress_analyzer/internal/report"
+)
+
+const (
+	FormatSlack = "slack"
+	FormatTeams = "teams"
+	FormatJSON  = "json"
+)
+
+// Slack rejects a section text longer than this with a 400
+const slackSectionLimit = 3000
+
+func Payload(format string, s Summary) (any, error) {
+	switch format {
+	case FormatSlack:
+		return slackPayload(s), nil
+	case FormatTeams:
+		return teamsPayload(s), nil
+	case FormatJSON:
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown webhook format %q", format)
+	}
+}
+
+func title(s Summary) string {
+	return fmt.Sprintf("VPC Egress Cost Analysis | %s | %s", s.Date, s.Region)
+}
+
+func headline(s Summary) string {
+	return fmt.Sprintf("Estimated NAT cost $%.2f for %.2f GB to %d destinations", s.TotalCostUSD, s.TotalGB, s.Destinations)
+}
+
+func destinationLines(s Summary) []string {
+	lines := make([]string, 0, len(s.TopDestinations))
+	for i, d := range s.TopDestinations {
+		label := d.Name
+		if d.AwsService != "" {
+			label = strings.TrimSpace(d.AwsService + " " + label)
+		}
+		if label != "" {
+			label = " (" + label + ")"
+		}
+		lines = append(lines, fmt.Sprintf("%d. %s%s: %.2f GB, $%.2f", i+1, d.IP, label, d.GB, d.CostUSD))
+	}
+	return lines
+}
+
+func recommendationLines(s Summary) []string {
+	lines := make([]string, 0, len(s.Recommendations))
+	for _, r := range s.Recommendations {
+		lines = append(lines, fmt.Sprintf("%s → %s endpoint: saves $%.2f/month", r.Service, r.EndpointType, r.NetSavingsMonthlyUSD))
+	}
+	return lines
+}
+
+func violationLines(s Summary) []string {
+	lines := make([]string, 0, len(s.BudgetViolations))
+	for _, v := range s.BudgetViolations {
+		icon := "⚠️"
+		if v.Level == report.BudgetCritical {
+			icon = "🛑"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s %s: %.2f %s > %.2f %s", icon, v.Level, v.Budget, v.Key, v.Value, v.Unit, v.Threshold, v.Unit))
+	}
+	if s.MoreViolations > 0 {
+		lines = append(lines, fmt.Sprintf("…and %d more", s.MoreViolations))
+	}
+	return lines
+}
+
+func slackPayload(s Summary) map[string]any {
+	section := func(heading string, lines []string) map[string]any {
+		text := "*" + heading + "*\n" + strings.Join(lines, "\n")
+		if r := []rune(text); len(r) > slackSectionLimit {
+			text = string(r[:slackSectionLimit-1]) + "…"
+		}
+		return map[string]any{
+			"type": "section",
+			"text": map[string]any{"type": "mrkdwn", "text": text},
+		}
+	}
+
+	blocks := []map[string]any{
+		{"type": "header", "text": map[string]any{"type": "plain_text", "text": "📊 " + title(s)}},
+		{"type": "section", "fields": []map[string]any{
+			{"type": "mrkdwn", "text": fmt.Sprintf("*NAT cost*\n$%.2f", s.TotalCostUSD)},
+			{"type": "mrkdwn", "text": fmt.Sprintf("*Data processed*\n%.2f GB", s.TotalGB)},
+			{"type": "mrkdwn", "text": fmt.Sprintf("*Destinations*\n%d", s.Destinations)},
+			{"type": "mrkdwn", "text": fmt.Sprintf("*Anomalies*\n%d", s.Anomalies)},
+		}},
+	}
+	if len(s.BudgetViolations) > 0 {
+		blocks = append(blocks, section("💸 Budget violations", violationLines(s)))
+	}
+	if len(s.TopDestinations) > 0 {
+		blocks = append(blocks, section("🏆 Top destinations", destinationLines(s)))
+	}
+	if len(s.Recommendations) > 0 {
+		blocks = append(blocks, section("💡 Recommendations", recommendationLines(s)))
+	}
+
+	return map[string]any{
+		"text":   title(s) + ": " + headline(s),
+		"blocks": blocks,
+	}
+}
+
+// teamsPayload builds an Adaptive Card message, as accepted by Teams workflows webhooks
+func teamsPayload(s Summary) map[string]any {
+	body := []map[string]any{
+		{"type": "TextBlock", "size": "Large", "weight": "Bolder", "wrap": true, "text": "📊 " + title(s)},
+		{"type": "FactSet", "facts": []map[string]any{
+			{"title": "NAT cost", "value": fmt.Sprintf("$%.2f", s.TotalCostUSD)},
+			{"title": "Data processed", "value": fmt.Sprintf("%.2f GB", s.TotalGB)},
+			{"title": "Destinations", "value": fmt.Sprintf("%d", s.Destinations)},
+			{"title": "Anomalies", "value": fmt.Sprintf("%d", s.Anomalies)},
+		}},
+	}
+	section := func(heading string, lines []string) {
+		body = append(body,
+			map[string]any{"type": "TextBlock", "weight": "Bolder", "spacing": "Medium", "text": heading},
+			map[string]any{"type": "TextBlock", "wrap": true, "text": "- " + strings.Join(lines, "\n- ")},
+		)
+	}
+	if len(s.BudgetViolations) > 0 {
+		section("💸 Budget violations", violationLines(s))
+	}
+	if len(s.TopDestinations) > 0 {
+		section("🏆 Top destinations", destinationLines(s))
+	}
+	if len(s.Recommendations) > 0 {
+		section("💡 Recommendations", recommendationLines(s))
+	}
+
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]any{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    body,
+			},
+		}},
+	}
+}
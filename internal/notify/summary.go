@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"sort"
+	"vpc_flowlogs_egress_analyzer/internal/cost"
+	"vpc_flowlogs_egress_analyzer/internal/report"
+)
+
+const (
+	topDestinations    = 5
+	topRecommendations = 3
+	topViolations      = 5
+)
+
+// Summary is the compact view of a report posted to webhooks, and the generic JSON payload
+type Summary struct {
+	Date             string                   `json:"date"`
+	Region           string                   `json:"region"`
+	TotalGB          float64                  `json:"total_gb"`
+	TotalCostUSD     float64                  `json:"total_cost_usd"`
+	Destinations     int                      `json:"destinations"`
+	TopDestinations  []SummaryDestination     `json:"top_destinations"`
+	Recommendations  []cost.Recommendation    `json:"recommendations"`
+	BudgetViolations []report.BudgetViolation `json:"budget_violations"`
+	MoreViolations   int                      `json:"more_budget_violations"`
+	Anomalies        int                      `json:"anomalies"`
+}
+
+type SummaryDestination struct {
+	IP         string  `json:"ip"`
+	Name       string  `json:"name,omitempty"`
+	AwsService string  `json:"aws_service,omitempty"`
+	GB         float64 `json:"gb"`
+	CostUSD    float64 `json:"cost_usd"`
+}
+
+func Summarize(r report.Report) Summary {
+	s := Summary{
+		Date:             r.Date(),
+		Region:           r.Region,
+		TotalGB:          r.Total.GB,
+		TotalCostUSD:     r.Total.CostUSD,
+		Destinations:     len(r.EgressByIP),
+		TopDestinations:  []SummaryDestination{},
+		Recommendations:  []cost.Recommendation{},
+		BudgetViolations: []report.BudgetViolation{},
+		Anomalies:        len(r.Anomalies),
+	}
+
+	for i, e := range r.EgressByIP {
+		if i == topDestinations {
+			break
+		}
+		name := ""
+		if e.Hostname != nil {
+			name = e.Hostname.Hostname
+		} else if e.IpInfo != nil {
+			name = e.IpInfo.AS_NAME
+		}
+		s.TopDestinations = append(s.TopDestinations, SummaryDestination{IP: e.IP, Name: name, AwsService: e.AwsService, GB: e.GB, CostUSD: e.CostUSD})
+	}
+
+	for _, rec := range r.Recommendations {
+		if len(s.Recommendations) == topRecommendations {
+			break
+		}
+		if rec.NetSavingsMonthlyUSD > 0 {
+			s.Recommendations = append(s.Recommendations, rec)
+		}
+	}
+
+	// Worst violations first: critical ones, then the most over their threshold
+	violations := append([]report.BudgetViolation{}, r.BudgetViolations...)
+	sort.SliceStable(violations, func(i, j int) bool {
+		a, b := violations[i], violations[j]
+		if a.Level != b.Level {
+			return a.Level == report.BudgetCritical
+		}
+		return overrun(a) > overrun(b)
+	})
+	if len(violations) > topViolations {
+		s.MoreViolations = len(violations) - topViolations
+		violations = violations[:topViolations]
+	}
+	s.BudgetViolations = append(s.BudgetViolations, violations...)
+	return s
+}
+
+func overrun(v report.BudgetViolation) float64 {
+	if v.Threshold <= 0 {
+		return v.Value
+	}
+	return v.Value / v.Threshold
+}
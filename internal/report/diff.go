@@ -0,0 +1,209 @@
+package report
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+type DiffSide struct {
+	Date    string  `json:"date"`
+	Region  string  `json:"region"`
+	Bytes   int     `json:"bytes"`
+	GB      float64 `json:"gb"`
+	CostUSD float64 `json:"cost_usd"`
+}
+
+type Mover struct {
+	Key          string  `json:"key"`
+	Label        string  `json:"label,omitempty"`
+	OldBytes     int     `json:"old_bytes"`
+	NewBytes     int     `json:"new_bytes"`
+	DeltaBytes   int     `json:"delta_bytes"`
+	OldGB        float64 `json:"old_gb"`
+	NewGB        float64 `json:"new_gb"`
+	DeltaGB      float64 `json:"delta_gb"`
+	OldCostUSD   float64 `json:"old_cost_usd"`
+	NewCostUSD   float64 `json:"new_cost_usd"`
+	DeltaCostUSD float64 `json:"delta_cost_usd"`
+}
+
+type Diff struct {
+	Old          DiffSide `json:"old"`
+	New          DiffSide `json:"new"`
+	DeltaBytes   int      `json:"delta_bytes"`
+	DeltaGB      float64  `json:"delta_gb"`
+	DeltaCostUSD float64  `json:"delta_cost_usd"`
+	// Relative cost change, 0 when the old cost is 0
+	DeltaCostPercent float64 `json:"delta_cost_percent"`
+
+	NewDestinations         []Mover `json:"new_destinations"`
+	DisappearedDestinations []Mover `json:"disappeared_destinations"`
+	DestinationMovers       []Mover `json:"destination_movers"`
+	SourceMovers            []Mover `json:"source_movers"`
+	AwsServiceMovers        []Mover `json:"aws_service_movers"`
+}
+
+type diffRow struct {
+	label   string
+	bytes   int
+	gb      float64
+	costUSD float64
+}
+
+// Compare reports what changed between two results. Movers are ranked by absolute cost
+// change and capped to topN entries per list, topN <= 0 means no cap.
+func Compare(before, after *Report, topN int) Diff {
+	d := Diff{
+		Old:          DiffSide{Date: before.Date(), Region: before.Region, Bytes: before.Total.Bytes, GB: before.Total.GB, CostUSD: before.Total.CostUSD},
+		New:          DiffSide{Date: after.Date(), Region: after.Region, Bytes: after.Total.Bytes, GB: after.Total.GB, CostUSD: after.Total.CostUSD},
+		DeltaBytes:   after.Total.Bytes - before.Total.Bytes,
+		DeltaGB:      after.Total.GB - before.Total.GB,
+		DeltaCostUSD: after.Total.CostUSD - before.Total.CostUSD,
+	}
+	if before.Total.CostUSD > 0 {
+		d.DeltaCostPercent = d.DeltaCostUSD / before.Total.CostUSD * 100
+	}
+
+	oldDest, newDest := destinationRows(before), destinationRows(after)
+	all := movers(oldDest, newDest)
+	for _, m := range all {
+		_, inOld := oldDest[m.Key]
+		_, inNew := newDest[m.Key]
+		switch {
+		case !inOld:
+			d.NewDestinations = append(d.NewDestinations, m)
+		case !inNew:
+			d.DisappearedDestinations = append(d.DisappearedDestinations, m)
+		}
+	}
+	d.NewDestinations = limit(d.NewDestinations, topN)
+	d.DisappearedDestinations = limit(d.DisappearedDestinations, topN)
+	d.DestinationMovers = limit(all, topN)
+	d.SourceMovers = limit(movers(sourceRows(before), sourceRows(after)), topN)
+	d.AwsServiceMovers = limit(movers(serviceRows(before), serviceRows(after)), topN)
+
+	return d
+}
+
+func destinationRows(r *Report) map[string]diffRow {
+	rows := make(map[string]diffRow, len(r.EgressByIP))
+	for _, e := range r.EgressByIP {
+		label := e.AwsService
+		if e.Hostname != nil {
+			label = e.Hostname.Hostname
+		} else if label == "" && e.IpInfo != nil {
+			label = e.IpInfo.AS_NAME
+		}
+		rows[e.IP] = diffRow{label: label, bytes: e.Bytes, gb: e.GB, costUSD: e.CostUSD}
+	}
+	return rows
+}
+
+func sourceRows(r *Report) map[string]diffRow {
+	rows := make(map[string]diffRow, len(r.EgressBySource))
+	for _, e := range r.EgressBySource {
+		rows[e.Source] = diffRow{label: e.InterfaceID, bytes: e.Bytes, gb: e.GB, costUSD: e.CostUSD}
+	}
+	return rows
+}
+
+func serviceRows(r *Report) map[string]diffRow {
+	rows := make(map[string]diffRow, len(r.EgressByAwsService))
+	for _, e := range r.EgressByAwsService {
+		rows[serviceKey(e)] = diffRow{label: e.Service, bytes: e.Bytes, gb: e.GB, costUSD: e.CostUSD}
+	}
+	return rows
+}
+
+func movers(before, after map[string]diffRow) []Mover {
+	keys := make(map[string]bool, len(before)+len(after))
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+
+	out := make([]Mover, 0, len(keys))
+	for k := range keys {
+		o, n := before[k], after[k]
+		label := n.label
+		if label == "" {
+			label = o.label
+		}
+		m := Mover{
+			Key:          k,
+			Label:        label,
+			OldBytes:     o.bytes,
+			NewBytes:     n.bytes,
+			DeltaBytes:   n.bytes - o.bytes,
+			OldGB:        o.gb,
+			NewGB:        n.gb,
+			DeltaGB:      n.gb - o.gb,
+			OldCostUSD:   o.costUSD,
+			NewCostUSD:   n.costUSD,
+			DeltaCostUSD: n.costUSD - o.costUSD,
+		}
+		if m.DeltaBytes == 0 && m.DeltaCostUSD == 0 {
+			continue
+		}
+		out = append(out, m)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		ci, cj := math.Abs(out[i].DeltaCostUSD), math.Abs(out[j].DeltaCostUSD)
+		if ci != cj {
+			return ci > cj
+		}
+		bi, bj := abs(out[i].DeltaBytes), abs(out[j].DeltaBytes)
+		if bi != bj {
+			return bi > bj
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func PrintDiff(d Diff) {
+	fmt.Println("\n=================================================================")
+	fmt.Printf("🔀 VPC Egress Diff | %s (%s) → %s (%s)\n", d.Old.Date, d.Old.Region, d.New.Date, d.New.Region)
+	fmt.Println("=================================================================")
+	fmt.Printf("💰 NAT Cost:        $%.2f → $%.2f   (%s, %+.1f%%)\n", d.Old.CostUSD, d.New.CostUSD, mdDeltaUSD(d.DeltaCostUSD), d.DeltaCostPercent)
+	fmt.Printf("📡 Data Processed:  %.2f GB → %.2f GB   (%+.2f GB)\n", d.Old.GB, d.New.GB, d.DeltaGB)
+
+	printMovers("🏆 Biggest destination movers", d.DestinationMovers)
+	printMovers("🆕 New destinations", d.NewDestinations)
+	printMovers("👋 Disappeared destinations", d.DisappearedDestinations)
+	printMovers("🖥️ Biggest source movers", d.SourceMovers)
+	printMovers("☁️ AWS service movers", d.AwsServiceMovers)
+	fmt.Println("=================================================================")
+}
+
+func printMovers(title string, movers []Mover) {
+	fmt.Println("-----------------------------------------------------------------")
+	fmt.Printf("%s:\n", title)
+	if len(movers) == 0 {
+		fmt.Println("   (none)")
+		return
+	}
+	fmt.Printf("   %-39s %-24s %12s %12s %10s\n", "KEY", "LABEL", "OLD GB", "NEW GB", "Δ COST")
+	for _, m := range movers {
+		fmt.Printf("   %-39s %-24s %12.2f %12.2f %10s\n", m.Key, truncate(m.Label, 24), m.OldGB, m.NewGB, mdDeltaUSD(m.DeltaCostUSD))
+	}
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,118 @@
+package report
+
+import (
+	"reflect"
+	"testing"
+	"vpc_flowlogs_egress_analyzer/internal/hostnames"
+)
+
+func diffReport(day string, costUSD float64, ips ...IPEntry) *Report {
+	r := &Report{Year: "2025", Month: "12", Day: day, Region: "eu-west-3"}
+	for _, e := range ips {
+		r.Total.Bytes += e.Bytes
+		r.Total.GB += e.GB
+		r.EgressByIP = append(r.EgressByIP, e)
+	}
+	r.Total.CostUSD = costUSD
+	return r
+}
+
+func keys(movers []Mover) []string {
+	out := []string{}
+	for _, m := range movers {
+		out = append(out, m.Key)
+	}
+	return out
+}
+
+func TestCompare(t *testing.T) {
+	before := diffReport("01", 10,
+		IPEntry{IP: "8.8.8.8", Bytes: 1000, GB: 1, CostUSD: 4},
+		IPEntry{IP: "1.1.1.1", Bytes: 500, GB: 0.5, CostUSD: 2, AwsService: "S3"},
+		IPEntry{IP: "9.9.9.9", Bytes: 100, GB: 0.1, CostUSD: 1},
+		IPEntry{IP: "4.4.4.4", Bytes: 300, GB: 0.3, CostUSD: 3},
+	)
+	after := diffReport("02", 15,
+		IPEntry{IP: "8.8.8.8", Bytes: 3000, GB: 3, CostUSD: 10, Hostname: &hostnames.Result{Hostname: "dns.google"}},
+		IPEntry{IP: "1.1.1.1", Bytes: 400, GB: 0.4, CostUSD: 1.5, AwsService: "S3"},
+		IPEntry{IP: "4.4.4.4", Bytes: 300, GB: 0.3, CostUSD: 3},
+		IPEntry{IP: "5.5.5.5", Bytes: 200, GB: 0.2, CostUSD: 0.5},
+	)
+	before.EgressBySource = []SourceEntry{{Source: "10.0.0.1", InterfaceID: "eni-1", Bytes: 1900, CostUSD: 10}}
+	after.EgressBySource = []SourceEntry{{Source: "10.0.0.1", InterfaceID: "eni-1", Bytes: 3900, CostUSD: 15}}
+	before.EgressByAwsService = []ServiceEntry{{Service: "S3", Region: "eu-west-3", Bytes: 500, CostUSD: 2}}
+	after.EgressByAwsService = []ServiceEntry{
+		{Service: "S3", Region: "eu-west-3", Bytes: 400, CostUSD: 1.5},
+		{Service: "S3", Region: "us-east-1", Bytes: 100, CostUSD: 0.2},
+	}
+
+	d := Compare(before, after, 0)
+
+	if d.Old.Date != "2025-12-01" || d.New.Date != "2025-12-02" {
+		t.Fatalf("dates %s → %s", d.Old.Date, d.New.Date)
+	}
+	if d.DeltaCostUSD != 5 || d.DeltaCostPercent != 50 || d.DeltaBytes != 2000 {
+		t.Fatalf("totals: delta $%.2f (%.1f%%), %d bytes", d.DeltaCostUSD, d.DeltaCostPercent, d.DeltaBytes)
+	}
+
+	// Unchanged destinations are not movers, the others rank by absolute cost change, then
+	// absolute bytes change
+	if got, want := keys(d.DestinationMovers), []string{"8.8.8.8", "9.9.9.9", "5.5.5.5", "1.1.1.1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("destination movers %v, expected %v", got, want)
+	}
+	if got := keys(d.NewDestinations); !reflect.DeepEqual(got, []string{"5.5.5.5"}) {
+		t.Fatalf("new destinations %v", got)
+	}
+	if got := keys(d.DisappearedDestinations); !reflect.DeepEqual(got, []string{"9.9.9.9"}) {
+		t.Fatalf("disappeared destinations %v", got)
+	}
+
+	changed := d.DestinationMovers[0]
+	if changed.Label != "dns.google" || changed.OldBytes != 1000 || changed.NewBytes != 3000 || changed.DeltaCostUSD != 6 {
+		t.Fatalf("changed destination %+v", changed)
+	}
+	gone := d.DisappearedDestinations[0]
+	if gone.NewBytes != 0 || gone.DeltaBytes != -100 || gone.DeltaCostUSD != -1 {
+		t.Fatalf("disappeared destination %+v", gone)
+	}
+	if d.DestinationMovers[3].Label != "S3" {
+		t.Fatalf("label falls back to the AWS service: %+v", d.DestinationMovers[3])
+	}
+
+	if got := keys(d.SourceMovers); !reflect.DeepEqual(got, []string{"10.0.0.1"}) {
+		t.Fatalf("source movers %v", got)
+	}
+	if got, want := keys(d.AwsServiceMovers), []string{"S3@eu-west-3", "S3@us-east-1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("service movers %v, expected %v", got, want)
+	}
+
+	capped := Compare(before, after, 2)
+	if len(capped.DestinationMovers) != 2 || len(capped.NewDestinations) != 1 {
+		t.Fatalf("topN 2 kept %d movers and %d new destinations", len(capped.DestinationMovers), len(capped.NewDestinations))
+	}
+}
+
+func TestCompareZeroBaseline(t *testing.T) {
+	before := diffReport("01", 0)
+	after := diffReport("02", 3, IPEntry{IP: "8.8.8.8", Bytes: 1000, GB: 1, CostUSD: 3})
+
+	d := Compare(before, after, 0)
+	if d.DeltaCostUSD != 3 || d.DeltaCostPercent != 0 {
+		t.Fatalf("delta $%.2f (%v%%), expected $3 and 0%% against a zero cost", d.DeltaCostUSD, d.DeltaCostPercent)
+	}
+	if got := keys(d.NewDestinations); !reflect.DeepEqual(got, []string{"8.8.8.8"}) {
+		t.Fatalf("new destinations %v", got)
+	}
+
+	// Both sides empty
+	d = Compare(before, before, 0)
+	if d.DeltaCostPercent != 0 || len(d.DestinationMovers) != 0 {
+		t.Fatalf("identical empty reports differ: %+v", d)
+	}
+
+	// Back to zero is a 100% drop
+	d = Compare(after, before, 0)
+	if d.DeltaCostPercent != -100 || len(d.DisappearedDestinations) != 1 {
+		t.Fatalf("drop to zero: %.1f%%, %d disappeared", d.DeltaCostPercent, len(d.DisappearedDestinations))
+	}
+}
@@ -0,0 +1,143 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Table is a flat view of one aggregation with stable column names, used by the
+// CSV and NDJSON exporters
+type Table struct {
+	Name    string
+	Columns []string
+	Rows    [][]any
+}
+
+func Tables(r Report) []Table {
+	date := r.Date()
+
+	destinations := Table{
+		Name:    "egress_by_destination",
+		Columns: []string{"date", "region", "ip", "hostname", "aws_service", "aws_region", "asn", "as_name", "country_code", "top_ports", "bytes", "gb", "cost_usd", "connection_num"},
+	}
+	for _, e := range r.EgressByIP {
+		hostname, asn, asName, country := "", "", "", ""
+		if e.Hostname != nil {
+			hostname = e.Hostname.Hostname
+		}
+		if e.IpInfo != nil {
+			asn, asName, country = e.IpInfo.ASN, e.IpInfo.AS_NAME, e.IpInfo.COUNTRY_CODE
+		}
+		ports := make([]string, 0, len(e.TopPorts))
+		for _, p := range e.TopPorts {
+			ports = append(ports, strconv.Itoa(p.Port))
+		}
+		destinations.Rows = append(destinations.Rows, []any{date, r.Region, e.IP, hostname, e.AwsService, e.AwsRegion, asn, asName, country, strings.Join(ports, ";"), e.Bytes, e.GB, e.CostUSD, e.ConnectionNum})
+	}
+
+	sources := Table{
+		Name:    "egress_by_source",
+		Columns: []string{"date", "region", "source", "interface_id", "bytes", "gb", "cost_usd", "connection_num"},
+	}
+	for _, e := range r.EgressBySource {
+		sources.Rows = append(sources.Rows, []any{date, r.Region, e.Source, e.InterfaceID, e.Bytes, e.GB, e.CostUSD, e.ConnectionNum})
+	}
+
+	services := Table{
+		Name:    "egress_by_aws_service",
+		Columns: []string{"date", "region", "service", "service_region", "cross_region", "bytes", "gb", "cost_usd", "connection_num"},
+	}
+	for _, e := range r.EgressByAwsService {
+		services.Rows = append(services.Rows, []any{date, r.Region, e.Service, e.Region, e.CrossRegion, e.Bytes, e.GB, e.CostUSD, e.ConnectionNum})
+	}
+
+	ports := Table{
+		Name:    "egress_by_port",
+		Columns: []string{"date", "region", "port", "service", "bytes", "gb", "cost_usd", "connection_num"},
+	}
+	for _, e := range r.EgressByPort {
+		ports.Rows = append(ports.Rows, []any{date, r.Region, e.Port, e.Service, e.Bytes, e.GB, e.CostUSD, e.ConnectionNum})
+	}
+
+	protocols := Table{
+		Name:    "egress_by_protocol",
+		Columns: []string{"date", "region", "protocol", "number", "bytes", "gb", "cost_usd", "connection_num"},
+	}
+	for _, e := range r.EgressByProtocol {
+		protocols.Rows = append(protocols.Rows, []any{date, r.Region, e.Protocol, e.Number, e.Bytes, e.GB, e.CostUSD, e.ConnectionNum})
+	}
+
+	hours := Table{
+		Name:    "egress_by_hour",
+		Columns: []string{"date", "region", "hour", "unix", "bytes", "gb", "cost_usd", "connection_num"},
+	}
+	for _, e := range r.EgressByHour {
+		hours.Rows = append(hours.Rows, []any{date, r.Region, e.Hour, e.Unix, e.Bytes, e.GB, e.CostUSD, e.ConnectionNum})
+	}
+
+	pairs := Table{
+		Name:    "egress_by_pair",
+		Columns: []string{"date", "region", "destination", "aws_service", "source", "interface_id", "bytes", "gb", "cost_usd", "connection_num"},
+	}
+	for _, e := range r.EgressByPair {
+		pairs.Rows = append(pairs.Rows, []any{date, r.Region, e.Destination, e.AwsService, e.Source, e.InterfaceID, e.Bytes, e.GB, e.CostUSD, e.ConnectionNum})
+	}
+
+	return []Table{destinations, sources, services, ports, protocols, hours, pairs}
+}
+
+func WriteCSV(w io.Writer, t Table) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(t.Columns); err != nil {
+		return fmt.Errorf("csv header: %w", err)
+	}
+
+	record := make([]string, len(t.Columns))
+	for _, row := range t.Rows {
+		for i, v := range row {
+			record[i] = csvValue(v)
+		}
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("csv row: %w", err)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteNDJSON writes one JSON object per row, keys in alphabetical order
+func WriteNDJSON(w io.Writer, t Table) error {
+	enc := json.NewEncoder(w)
+	obj := make(map[string]any, len(t.Columns))
+	for _, row := range t.Rows {
+		for i, col := range t.Columns {
+			obj[col] = row[i]
+		}
+		if err := enc.Encode(obj); err != nil {
+			return fmt.Errorf("ndjson row: %w", err)
+		}
+	}
+	return nil
+}
+
+func csvValue(v any) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case int:
+		return strconv.Itoa(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(x)
+	default:
+		return fmt.Sprint(x)
+	}
+}
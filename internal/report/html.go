@@ -0,0 +1,147 @@
+package report
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"vpc_flowlogs_egress_analyzer/internal/cost"
+)
+
+//go:embed templates/report.html
+var htmlTemplate string
+
+// Tables are capped so reports stay small enough for a browser
+const htmlMaxRows = 500
+
+type bar struct {
+	Label   string
+	Value   float64
+	Percent float64
+	Title   string
+}
+
+type htmlView struct {
+	Report
+	Destinations      []IPEntry
+	Sources           []SourceEntry
+	SavingsMonthlyUSD float64
+	ServiceBars       []bar
+	HourBars          []bar
+	MaxRows           int
+}
+
+var htmlFuncs = template.FuncMap{
+	"gb": func(v float64) string {
+		return fmt.Sprintf("%.2f", v)
+	},
+	"gbBytes": func(b int) string {
+		return fmt.Sprintf("%.2f", bytesToGB(b))
+	},
+	"usd": func(v float64) string {
+		return fmt.Sprintf("$%.2f", v)
+	},
+	"hostname": func(e IPEntry) string {
+		if e.Hostname == nil {
+			return ""
+		}
+		return e.Hostname.Hostname
+	},
+	"asn": func(e IPEntry) string {
+		if e.IpInfo == nil {
+			return ""
+		}
+		return strings.TrimSpace(e.IpInfo.ASN + " " + e.IpInfo.AS_NAME)
+	},
+	"country": func(e IPEntry) string {
+		if e.IpInfo == nil {
+			return ""
+		}
+		return e.IpInfo.COUNTRY_CODE
+	},
+	"ports": func(ports []PortEntry) string {
+		parts := make([]string, 0, len(ports))
+		for _, p := range ports {
+			if p.Service != "" {
+				parts = append(parts, fmt.Sprintf("%d/%s", p.Port, p.Service))
+			} else {
+				parts = append(parts, fmt.Sprintf("%d", p.Port))
+			}
+		}
+		return strings.Join(parts, ", ")
+	},
+	"actionable": func(r cost.Recommendation) bool {
+		return r.EndpointType == cost.EndpointGateway || r.EndpointType == cost.EndpointInterface
+	},
+}
+
+// WriteHTML renders a single self-contained HTML page, no external assets
+func WriteHTML(w io.Writer, r Report) error {
+	tmpl, err := template.New("report").Funcs(htmlFuncs).Parse(htmlTemplate)
+	if err != nil {
+		return fmt.Errorf("parse html template: %w", err)
+	}
+
+	view := htmlView{
+		Report:       r,
+		Destinations: r.EgressByIP,
+		Sources:      r.EgressBySource,
+		MaxRows:      htmlMaxRows,
+	}
+	if len(view.Destinations) > htmlMaxRows {
+		view.Destinations = view.Destinations[:htmlMaxRows]
+	}
+	if len(view.Sources) > htmlMaxRows {
+		view.Sources = view.Sources[:htmlMaxRows]
+	}
+
+	for _, rec := range r.Recommendations {
+		if rec.NetSavingsMonthlyUSD > 0 {
+			view.SavingsMonthlyUSD += rec.NetSavingsMonthlyUSD
+		}
+	}
+
+	var maxServiceCost float64
+	for _, s := range r.EgressByAwsService {
+		if s.CostUSD > maxServiceCost {
+			maxServiceCost = s.CostUSD
+		}
+	}
+	for _, s := range r.EgressByAwsService {
+		label := s.Service
+		if s.Region != "" {
+			label += " (" + s.Region + ")"
+		}
+		view.ServiceBars = append(view.ServiceBars, bar{
+			Label:   label,
+			Value:   s.CostUSD,
+			Percent: percent(s.CostUSD, maxServiceCost),
+			Title:   fmt.Sprintf("%s: $%.2f, %.2f GB", label, s.CostUSD, s.GB),
+		})
+	}
+
+	var maxHourGB float64
+	for _, h := range r.EgressByHour {
+		if h.GB > maxHourGB {
+			maxHourGB = h.GB
+		}
+	}
+	for _, h := range r.EgressByHour {
+		view.HourBars = append(view.HourBars, bar{
+			Label:   h.Hour[11:13] + "h",
+			Value:   h.GB,
+			Percent: percent(h.GB, maxHourGB),
+			Title:   fmt.Sprintf("%s: %.2f GB, $%.2f", h.Hour, h.GB, h.CostUSD),
+		})
+	}
+
+	return tmpl.Execute(w, view)
+}
+
+func percent(v, max float64) float64 {
+	if max <= 0 {
+		return 0
+	}
+	return v / max * 100
+}
@@ -0,0 +1,220 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"vpc_flowlogs_egress_analyzer/internal/cost"
+)
+
+// WriteMarkdown renders the report for wikis and pull requests. Output only depends on
+// the report content (fixed precision, deterministic ordering) so it can be committed
+// and diffed. When prev is not nil, totals and rows show the change since prev.
+func WriteMarkdown(w io.Writer, r Report, prev *Report, topN int) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# VPC Egress Cost Analysis: %s (%s)\n\n", r.Date(), r.Region)
+	if prev != nil {
+		fmt.Fprintf(&b, "Compared with %s (%s).\n\n", prev.Date(), prev.Region)
+	}
+
+	b.WriteString("## Totals\n\n")
+	if prev != nil {
+		b.WriteString("| Metric | Value | Previous | Change |\n|:--|--:|--:|--:|\n")
+		fmt.Fprintf(&b, "| Estimated NAT cost | %s | %s | %s |\n", mdUSD(r.Total.CostUSD), mdUSD(prev.Total.CostUSD), mdDeltaUSD(r.Total.CostUSD-prev.Total.CostUSD))
+		fmt.Fprintf(&b, "| Data processed | %s | %s | %s |\n", mdGB(r.Total.GB), mdGB(prev.Total.GB), mdDeltaGB(r.Total.GB-prev.Total.GB))
+		fmt.Fprintf(&b, "| Unique destinations | %d | %d | %+d |\n", len(r.EgressByIP), len(prev.EgressByIP), len(r.EgressByIP)-len(prev.EgressByIP))
+		fmt.Fprintf(&b, "| Unique sources | %d | %d | %+d |\n", len(r.EgressBySource), len(prev.EgressBySource), len(r.EgressBySource)-len(prev.EgressBySource))
+		fmt.Fprintf(&b, "| AWS traffic cross-region | %s | %s | %s |\n", mdGB(r.AwsTrafficByRegionScope.CrossRegion.GB), mdGB(prev.AwsTrafficByRegionScope.CrossRegion.GB), mdDeltaGB(r.AwsTrafficByRegionScope.CrossRegion.GB-prev.AwsTrafficByRegionScope.CrossRegion.GB))
+	} else {
+		b.WriteString("| Metric | Value |\n|:--|--:|\n")
+		fmt.Fprintf(&b, "| Estimated NAT cost | %s |\n", mdUSD(r.Total.CostUSD))
+		fmt.Fprintf(&b, "| Data processed | %s |\n", mdGB(r.Total.GB))
+		fmt.Fprintf(&b, "| Unique destinations | %d |\n", len(r.EgressByIP))
+		fmt.Fprintf(&b, "| Unique sources | %d |\n", len(r.EgressBySource))
+		fmt.Fprintf(&b, "| AWS traffic cross-region | %s |\n", mdGB(r.AwsTrafficByRegionScope.CrossRegion.GB))
+	}
+	b.WriteString("\n")
+
+	var prevDest, prevSrc, prevSvc map[string]float64
+	if prev != nil {
+		prevDest, prevSrc, prevSvc = map[string]float64{}, map[string]float64{}, map[string]float64{}
+		for _, e := range prev.EgressByIP {
+			prevDest[e.IP] = e.GB
+		}
+		for _, e := range prev.EgressBySource {
+			prevSrc[e.Source] = e.GB
+		}
+		for _, e := range prev.EgressByAwsService {
+			prevSvc[serviceKey(e)] = e.GB
+		}
+	}
+
+	dests := append([]IPEntry(nil), r.EgressByIP...)
+	sort.Slice(dests, func(i, j int) bool {
+		if dests[i].Bytes != dests[j].Bytes {
+			return dests[i].Bytes > dests[j].Bytes
+		}
+		return dests[i].IP < dests[j].IP
+	})
+	fmt.Fprintf(&b, "## Top %d destinations\n\n", topN)
+	b.WriteString("| # | IP | Name | AWS service | GB | Cost |" + mdDeltaHeader(prev) + "\n|--:|:--|:--|:--|--:|--:|" + mdDeltaAlign(prev) + "\n")
+	for i, e := range limit(dests, topN) {
+		name := ""
+		if e.Hostname != nil {
+			name = e.Hostname.Hostname
+		} else if e.IpInfo != nil {
+			name = e.IpInfo.AS_NAME
+		}
+		service := e.AwsService
+		if service != "" && e.AwsRegion != "" {
+			service += " (" + e.AwsRegion + ")"
+		}
+		fmt.Fprintf(&b, "| %d | `%s` | %s | %s | %s | %s |%s\n", i+1, e.IP, mdEscape(name), service, mdGB(e.GB), mdUSD(e.CostUSD), mdRowDelta(prevDest, e.IP, e.GB))
+	}
+	b.WriteString("\n")
+
+	srcs := append([]SourceEntry(nil), r.EgressBySource...)
+	sort.Slice(srcs, func(i, j int) bool {
+		if srcs[i].Bytes != srcs[j].Bytes {
+			return srcs[i].Bytes > srcs[j].Bytes
+		}
+		return srcs[i].Source < srcs[j].Source
+	})
+	fmt.Fprintf(&b, "## Top %d sources\n\n", topN)
+	b.WriteString("| # | Source | Interface | GB | Cost |" + mdDeltaHeader(prev) + "\n|--:|:--|:--|--:|--:|" + mdDeltaAlign(prev) + "\n")
+	for i, e := range limit(srcs, topN) {
+		fmt.Fprintf(&b, "| %d | `%s` | %s | %s | %s |%s\n", i+1, e.Source, e.InterfaceID, mdGB(e.GB), mdUSD(e.CostUSD), mdRowDelta(prevSrc, e.Source, e.GB))
+	}
+	b.WriteString("\n")
+
+	svcs := append([]ServiceEntry(nil), r.EgressByAwsService...)
+	sort.Slice(svcs, func(i, j int) bool {
+		if svcs[i].Bytes != svcs[j].Bytes {
+			return svcs[i].Bytes > svcs[j].Bytes
+		}
+		return serviceKey(svcs[i]) < serviceKey(svcs[j])
+	})
+	fmt.Fprintf(&b, "## Top %d AWS services through NAT\n\n", topN)
+	if len(svcs) == 0 {
+		b.WriteString("No AWS service traffic through NAT.\n\n")
+	} else {
+		b.WriteString("| # | Service | Region | Cross-region | GB | Cost |" + mdDeltaHeader(prev) + "\n|--:|:--|:--|:--|--:|--:|" + mdDeltaAlign(prev) + "\n")
+		for i, e := range limit(svcs, topN) {
+			cross := ""
+			if e.CrossRegion {
+				cross = "yes"
+			}
+			fmt.Fprintf(&b, "| %d | %s | %s | %s | %s | %s |%s\n", i+1, e.Service, e.Region, cross, mdGB(e.GB), mdUSD(e.CostUSD), mdRowDelta(prevSvc, serviceKey(e), e.GB))
+		}
+		b.WriteString("\n")
+	}
+
+	if len(r.BudgetViolations) > 0 {
+		b.WriteString("## Budget violations\n\n")
+		b.WriteString("| Level | Budget | Key | Value | Threshold |\n|:--|:--|:--|--:|--:|\n")
+		for _, v := range r.BudgetViolations {
+			fmt.Fprintf(&b, "| %s | %s | `%s` | %.2f %s | %.2f %s |\n", v.Level, v.Budget, v.Key, v.Value, v.Unit, v.Threshold, v.Unit)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(r.Anomalies) > 0 {
+		b.WriteString("## Anomalies\n\n")
+		b.WriteString("| Kind | Key | Reason | GB | Baseline GB | Score |\n|:--|:--|:--|--:|--:|--:|\n")
+		for _, a := range r.Anomalies {
+			fmt.Fprintf(&b, "| %s | `%s` | %s | %s | %s | %.1f |\n", a.Kind, a.Key, a.Reason, mdGB(bytesToGB(a.Bytes)), mdGB(bytesToGB(a.BaselineBytes)), a.Score)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("## Recommendations\n\n")
+	if len(r.Recommendations) == 0 {
+		b.WriteString("No AWS service traffic through NAT.\n")
+	} else {
+		b.WriteString("| # | Service | Action | NAT cost / month | Endpoint cost / month | Net savings / month |\n|--:|:--|:--|--:|--:|--:|\n")
+		for i, rec := range r.Recommendations {
+			action, endpointCost, savings := rec.EndpointType+" endpoint", mdUSD(rec.EndpointCostMonthlyUSD), mdUSD(rec.NetSavingsMonthlyUSD)
+			switch rec.EndpointType {
+			case cost.EndpointCrossRegion:
+				action, endpointCost, savings = "cross-region ("+rec.Region+")", "", ""
+			case cost.EndpointInvestigate:
+				action, endpointCost, savings = "investigate", "", ""
+			}
+			fmt.Fprintf(&b, "| %d | %s | %s | %s | %s | %s |\n", i+1, rec.Service, action, mdUSD(rec.NatCostMonthlyUSD), endpointCost, savings)
+		}
+		b.WriteString("\n")
+		for _, rec := range r.Recommendations {
+			if rec.Note != "" {
+				fmt.Fprintf(&b, "- **%s**: %s\n", rec.Service, mdEscape(rec.Note))
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func serviceKey(e ServiceEntry) string {
+	return e.Service + "@" + e.Region
+}
+
+func limit[T any](s []T, n int) []T {
+	if n > 0 && len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+func mdGB(v float64) string {
+	return fmt.Sprintf("%.2f GB", v)
+}
+
+func mdUSD(v float64) string {
+	return fmt.Sprintf("$%.2f", v)
+}
+
+func mdDeltaGB(v float64) string {
+	return fmt.Sprintf("%+.2f GB", v)
+}
+
+func mdDeltaUSD(v float64) string {
+	if v < 0 {
+		return fmt.Sprintf("-$%.2f", -v)
+	}
+	return fmt.Sprintf("+$%.2f", v)
+}
+
+func mdDeltaHeader(prev *Report) string {
+	if prev == nil {
+		return ""
+	}
+	return " Change |"
+}
+
+func mdDeltaAlign(prev *Report) string {
+	if prev == nil {
+		return ""
+	}
+	return "--:|"
+}
+
+func mdRowDelta(prev map[string]float64, key string, gb float64) string {
+	if prev == nil {
+		return ""
+	}
+	before, ok := prev[key]
+	if !ok {
+		return " new |"
+	}
+	return " " + mdDeltaGB(gb-before) + " |"
+}
+
+func mdEscape(s string) string {
+	return strings.ReplaceAll(s, "|", "\\|")
+}
+
+func bytesToGB(b int) float64 {
+	return float64(b) / (1024 * 1024 * 1024)
+}
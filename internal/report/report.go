@@ -0,0 +1,183 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"vpc_flowlogs_egress_analyzer/internal/cost"
+	"vpc_flowlogs_egress_analyzer/internal/hostnames"
+	"vpc_flowlogs_egress_analyzer/internal/ipInfo"
+)
+
+// Report is the analysis result as written to result.json, and the input of every renderer
+type Report struct {
+	Year         string  `json:"year"`
+	Month        string  `json:"month"`
+	Day          string  `json:"day"`
+	Region       string  `json:"region"`
+	CostPerGBUSD float64 `json:"cost_per_gb_usd"`
+	Total        Total   `json:"total"`
+
+	EgressByIP              []IPEntry             `json:"egress_by_ip"`
+	EgressBySource          []SourceEntry         `json:"egress_by_source"`
+	EgressByProtocol        []ProtocolEntry       `json:"egress_by_protocol"`
+	EgressByPort            []PortEntry           `json:"egress_by_port"`
+	EgressByAwsService      []ServiceEntry        `json:"egress_by_aws_service"`
+	EgressByHour            []HourEntry           `json:"egress_by_hour"`
+	EgressByPair            []PairEntry           `json:"egress_by_pair"`
+	AwsTrafficByRegionScope RegionScope           `json:"aws_traffic_by_region_scope"`
+	Recommendations         []cost.Recommendation `json:"recommendations"`
+	Anomalies               []Anomaly             `json:"anomalies,omitempty"`
+	BudgetViolations        []BudgetViolation     `json:"budget_violations,omitempty"`
+}
+
+type Total struct {
+	Bytes   int     `json:"bytes"`
+	GB      float64 `json:"gb"`
+	CostUSD float64 `json:"cost_usd"`
+}
+
+type Traffic struct {
+	Bytes         int     `json:"bytes"`
+	GB            float64 `json:"gb"`
+	CostUSD       float64 `json:"cost_usd"`
+	ConnectionNum int     `json:"connection_num"`
+}
+
+// IPEntry est la structure finale pour le JSON
+type IPEntry struct {
+	IP            string                 `json:"ip"`
+	AwsService    string                 `json:"aws_service,omitempty"`
+	AwsRegion     string                 `json:"aws_region,omitempty"`
+	Direction     string                 `json:"direction"`
+	Bytes         int                    `json:"bytes"`
+	GB            float64                `json:"gb"`
+	CostUSD       float64                `json:"cost_usd"`
+	ConnectionNum int                    `json:"connection_num"`
+	TopPorts      []PortEntry            `json:"top_ports,omitempty"`
+	Hostname      *hostnames.Result      `json:"hostname,omitempty"`
+	IpInfo        *ipInfo.IpInfoResponse `json:"ipinfo"`
+}
+
+type SourceEntry struct {
+	Source        string  `json:"source"`
+	InterfaceID   string  `json:"interface_id,omitempty"`
+	Bytes         int     `json:"bytes"`
+	GB            float64 `json:"gb"`
+	CostUSD       float64 `json:"cost_usd"`
+	ConnectionNum int     `json:"connection_num"`
+}
+
+type ProtocolEntry struct {
+	Protocol      string  `json:"protocol"`
+	Number        int     `json:"number"`
+	Bytes         int     `json:"bytes"`
+	GB            float64 `json:"gb"`
+	CostUSD       float64 `json:"cost_usd"`
+	ConnectionNum int     `json:"connection_num"`
+}
+
+type PortEntry struct {
+	Port          int     `json:"port"`
+	Service       string  `json:"service,omitempty"`
+	Bytes         int     `json:"bytes"`
+	GB            float64 `json:"gb"`
+	CostUSD       float64 `json:"cost_usd"`
+	ConnectionNum int     `json:"connection_num"`
+}
+
+type ServiceEntry struct {
+	Service       string  `json:"service"`
+	Region        string  `json:"region,omitempty"`
+	CrossRegion   bool    `json:"cross_region"`
+	Bytes         int     `json:"bytes"`
+	GB            float64 `json:"gb"`
+	CostUSD       float64 `json:"cost_usd"`
+	ConnectionNum int     `json:"connection_num"`
+}
+
+// PairEntry is the traffic from one source, through one ENI, to one destination
+type PairEntry struct {
+	Destination   string  `json:"destination"`
+	AwsService    string  `json:"aws_service,omitempty"`
+	Source        string  `json:"source"`
+	InterfaceID   string  `json:"interface_id"`
+	Bytes         int     `json:"bytes"`
+	GB            float64 `json:"gb"`
+	CostUSD       float64 `json:"cost_usd"`
+	ConnectionNum int     `json:"connection_num"`
+}
+
+// HourEntry aggregates flows by the UTC hour they started in
+type HourEntry struct {
+	Hour          string  `json:"hour"`
+	Unix          int64   `json:"unix"`
+	Bytes         int     `json:"bytes"`
+	GB            float64 `json:"gb"`
+	CostUSD       float64 `json:"cost_usd"`
+	ConnectionNum int     `json:"connection_num"`
+}
+
+// RegionScope splits AWS service traffic between the analyzed region and others
+type RegionScope struct {
+	InRegion      Traffic `json:"in_region"`
+	CrossRegion   Traffic `json:"cross_region"`
+	UnknownRegion Traffic `json:"unknown_region"`
+}
+
+func (r Report) Date() string {
+	return r.Year + "-" + r.Month + "-" + r.Day
+}
+
+func Load(path string) (*Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open result: %w", err)
+	}
+	defer f.Close()
+
+	var r Report
+	if err := json.NewDecoder(f).Decode(&r); err != nil {
+		return nil, fmt.Errorf("json decode %s: %w", path, err)
+	}
+	return &r, nil
+}
+
+const (
+	AnomalyDestination = "destination"
+	AnomalySource      = "source"
+
+	AnomalyAboveBaseline = "above_baseline"
+	AnomalyNewHighVolume = "new_high_volume"
+)
+
+type Anomaly struct {
+	Kind           string  `json:"kind"`
+	Key            string  `json:"key"`
+	Reason         string  `json:"reason"`
+	Bytes          int     `json:"bytes"`
+	BaselineBytes  int     `json:"baseline_bytes"`
+	MADBytes       int     `json:"mad_bytes"`
+	ThresholdBytes int     `json:"threshold_bytes"`
+	Score          float64 `json:"score"`
+	HistoryDays    int     `json:"history_days"`
+}
+
+const (
+	BudgetDailyCost     = "daily_cost"
+	BudgetServiceCost   = "service_cost"
+	BudgetDestinationGB = "destination_gb"
+	BudgetSourceGB      = "source_gb"
+
+	BudgetWarning  = "warning"
+	BudgetCritical = "critical"
+)
+
+type BudgetViolation struct {
+	Budget    string  `json:"budget"`
+	Key       string  `json:"key"`
+	Level     string  `json:"level"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Unit      string  `json:"unit"`
+}
@@ -21,23 +21,7 @@ func GetS3Client() (*s3.Client, error) {
 
 	initS3Client.Do(func() {
 		var cfg aws.Config
-		opts := []func(*awsconfig.LoadOptions) error{
-			awsconfig.WithRegion(config.GetEnv("AWS_REGION")),
-		}
-		accessKey := config.GetEnv("AWS_ACCESS_KEY_ID")
-		secretKey := config.GetEnv("AWS_SECRET_ACCESS_KEY")
-		if accessKey != "" && secretKey != "" {
-			opts = append(opts, awsconfig.WithCredentialsProvider(
-				aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
-					return aws.Credentials{
-						AccessKeyID:     accessKey,
-						SecretAccessKey: secretKey,
-					}, nil
-				}),
-			))
-		}
-
-		cfg, err = awsconfig.LoadDefaultConfig(context.TODO(), opts...)
+		cfg, err = loadConfig(config.GetEnv("AWS_REGION"), config.GetEnv("AWS_ACCESS_KEY_ID"), config.GetEnv("AWS_SECRET_ACCESS_KEY"))
 		if err == nil {
 			s3Client = s3.NewFromConfig(cfg)
 		}
@@ -48,3 +32,35 @@ func GetS3Client() (*s3.Client, error) {
 	}
 	return s3Client, nil
 }
+
+// NewClient creates a client for an S3-compatible store, MinIO and most self-hosted
+// stores need a custom endpoint and path-style addressing
+func NewClient(region, endpoint string, pathStyle bool, accessKey, secretKey string) (*s3.Client, error) {
+	cfg, err := loadConfig(region, accessKey, secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("error loading AWS configuration: %w", err)
+	}
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+		o.UsePathStyle = pathStyle
+	}), nil
+}
+
+func loadConfig(region, accessKey, secretKey string) (aws.Config, error) {
+	opts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(region),
+	}
+	if accessKey != "" && secretKey != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+				return aws.Credentials{
+					AccessKeyID:     accessKey,
+					SecretAccessKey: secretKey,
+				}, nil
+			}),
+		))
+	}
+	return awsconfig.LoadDefaultConfig(context.TODO(), opts...)
+}
@@ -0,0 +1,69 @@
+package sqlite
+
+// schemaVersion is stored in the user_version pragma. Bump it whenever a table changes:
+// databases of another version are refused instead of being written with mismatched columns.
+const schemaVersion = 1
+
+// Schema of the flow tables. Aggregate tables (egress_by_*) share the columns of the CSV
+// export, recommendations, anomalies and budget_violations mirror result.json. Every table
+// carries date and region so several runs can live in the same database.
+const flowSchema = `
+-- One row per run, replaced when the same day and region is written again
+CREATE TABLE IF NOT EXISTS runs (
+	date            TEXT NOT NULL,
+	region          TEXT NOT NULL,
+	cost_per_gb_usd REAL NOT NULL,
+	bytes           INTEGER NOT NULL,
+	gb              REAL NOT NULL,
+	cost_usd        REAL NOT NULL,
+	written_at      TEXT NOT NULL,
+	PRIMARY KEY (date, region)
+);
+
+-- Parsed flow log records (SQLITE_FLOWS=records). source and destination are the
+-- pkt-srcaddr / pkt-dstaddr when present, start and end are unix seconds.
+CREATE TABLE IF NOT EXISTS flows (
+	date        TEXT NOT NULL,
+	region      TEXT NOT NULL,
+	start       INTEGER NOT NULL,
+	end         INTEGER NOT NULL,
+	interface_id TEXT NOT NULL,
+	direction   TEXT NOT NULL,
+	action      TEXT NOT NULL,
+	source      TEXT NOT NULL,
+	destination TEXT NOT NULL,
+	src_port    INTEGER NOT NULL,
+	dst_port    INTEGER NOT NULL,
+	protocol    INTEGER NOT NULL,
+	aws_service TEXT NOT NULL,
+	packets     INTEGER NOT NULL,
+	bytes       INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS flows_run ON flows (date, region);
+CREATE INDEX IF NOT EXISTS flows_destination ON flows (destination);
+CREATE INDEX IF NOT EXISTS flows_source ON flows (source);
+CREATE INDEX IF NOT EXISTS flows_start ON flows (start);
+
+-- Flows rolled up per minute of their start time (SQLITE_FLOWS=minute), source
+-- ports are dropped, flows is the number of records merged into the row
+CREATE TABLE IF NOT EXISTS flows_by_minute (
+	date        TEXT NOT NULL,
+	region      TEXT NOT NULL,
+	minute      INTEGER NOT NULL,
+	interface_id TEXT NOT NULL,
+	direction   TEXT NOT NULL,
+	action      TEXT NOT NULL,
+	source      TEXT NOT NULL,
+	destination TEXT NOT NULL,
+	dst_port    INTEGER NOT NULL,
+	protocol    INTEGER NOT NULL,
+	aws_service TEXT NOT NULL,
+	packets     INTEGER NOT NULL,
+	bytes       INTEGER NOT NULL,
+	flows       INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS flows_by_minute_run ON flows_by_minute (date, region);
+CREATE INDEX IF NOT EXISTS flows_by_minute_destination ON flows_by_minute (destination);
+CREATE INDEX IF NOT EXISTS flows_by_minute_source ON flows_by_minute (source);
+CREATE INDEX IF NOT EXISTS flows_by_minute_minute ON flows_by_minute (minute);
+`
@@ -0,0 +1,336 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+	"time"
+	"vpc_flowlogs_egress_analyzer/internal/report"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	FlowsNone    = "none"
+	FlowsRecords = "records"
+	FlowsMinute  = "minute"
+)
+
+// Flow is one flow log record, with source and destination already resolved
+type Flow struct {
+	Start       int64
+	End         int64
+	InterfaceID string
+	Direction   string
+	Action      string
+	Source      string
+	Destination string
+	SrcPort     int
+	DstPort     int
+	Protocol    int
+	AwsService  string
+	Packets     int
+	Bytes       int
+}
+
+type minuteKey struct {
+	Minute      int64
+	InterfaceID string
+	Direction   string
+	Action      string
+	Source      string
+	Destination string
+	DstPort     int
+	Protocol    int
+	AwsService  string
+}
+
+type minuteStats struct {
+	Packets int
+	Bytes   int
+	Flows   int
+}
+
+// Write stores the report aggregates and the flows into the database at path. Rows of an
+// earlier run for the same day and region are replaced, other days are kept.
+func Write(path string, r report.Report, flows iter.Seq[Flow], mode string) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer db.Close()
+
+	tables := append(report.Tables(r), extraTables(r)...)
+	if err := checkSchema(db, path, tables); err != nil {
+		return err
+	}
+	if err := createSchema(db, tables); err != nil {
+		return err
+	}
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion)); err != nil {
+		return fmt.Errorf("set schema version: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	date := r.Date()
+	for _, name := range append([]string{"runs", "flows", "flows_by_minute"}, tableNames(tables)...) {
+		if _, err := tx.Exec("DELETE FROM "+name+" WHERE date = ? AND region = ?", date, r.Region); err != nil {
+			return fmt.Errorf("clear %s: %w", name, err)
+		}
+	}
+
+	if _, err := tx.Exec("INSERT INTO runs VALUES (?, ?, ?, ?, ?, ?, ?)",
+		date, r.Region, r.CostPerGBUSD, r.Total.Bytes, r.Total.GB, r.Total.CostUSD, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("insert run: %w", err)
+	}
+
+	for _, t := range tables {
+		if err := insertTable(tx, t); err != nil {
+			return err
+		}
+	}
+
+	switch mode {
+	case FlowsRecords:
+		err = insertFlows(tx, date, r.Region, flows)
+	case FlowsMinute:
+		err = insertMinutes(tx, date, r.Region, flows)
+	case FlowsNone, "":
+	default:
+		err = fmt.Errorf("unknown SQLITE_FLOWS mode %q", mode)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func createSchema(db *sql.DB, tables []report.Table) error {
+	if _, err := db.Exec(flowSchema); err != nil {
+		return fmt.Errorf("create schema: %w", err)
+	}
+	for _, t := range tables {
+		if _, err := db.Exec(createTable(t)); err != nil {
+			return fmt.Errorf("create %s: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// checkSchema refuses a database written with another schema version, or whose tables do
+// not have the columns of this version. Databases from before the version was recorded are
+// accepted when their columns match.
+func checkSchema(db *sql.DB, path string, tables []report.Table) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("read schema version of %s: %w", path, err)
+	}
+	if version != 0 && version != schemaVersion {
+		return fmt.Errorf("%s has schema version %d, this version writes %d: set SQLITE_FILE to a new file or remove it",
+			path, version, schemaVersion)
+	}
+
+	// The expected columns are those of the schema created in an empty database
+	want, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return fmt.Errorf("open schema: %w", err)
+	}
+	defer want.Close()
+	// Every connection has its own in-memory database
+	want.SetMaxOpenConns(1)
+	if err := createSchema(want, tables); err != nil {
+		return err
+	}
+
+	for _, name := range append([]string{"runs", "flows", "flows_by_minute"}, tableNames(tables)...) {
+		got, err := tableColumns(db, name)
+		if err != nil {
+			return err
+		}
+		expected, err := tableColumns(want, name)
+		if err != nil {
+			return err
+		}
+		if len(got) > 0 && !slices.Equal(got, expected) {
+			return fmt.Errorf("%s was written with another schema, table %s has columns (%s), expected (%s): set SQLITE_FILE to a new file or remove it",
+				path, name, strings.Join(got, ", "), strings.Join(expected, ", "))
+		}
+	}
+	return nil
+}
+
+// tableColumns returns the "name type" of each column of table, none when it does not exist
+func tableColumns(db *sql.DB, table string) ([]string, error) {
+	rows, err := db.Query("SELECT name, type FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, fmt.Errorf("read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			return nil, fmt.Errorf("read columns of %s: %w", table, err)
+		}
+		cols = append(cols, name+" "+typ)
+	}
+	return cols, rows.Err()
+}
+
+func insertFlows(tx *sql.Tx, date, region string, flows iter.Seq[Flow]) error {
+	stmt, err := tx.Prepare("INSERT INTO flows VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("prepare flows: %w", err)
+	}
+	defer stmt.Close()
+
+	for f := range flows {
+		if _, err := stmt.Exec(date, region, f.Start, f.End, f.InterfaceID, f.Direction, f.Action, f.Source, f.Destination,
+			f.SrcPort, f.DstPort, f.Protocol, f.AwsService, f.Packets, f.Bytes); err != nil {
+			return fmt.Errorf("insert flow: %w", err)
+		}
+	}
+	return nil
+}
+
+func insertMinutes(tx *sql.Tx, date, region string, flows iter.Seq[Flow]) error {
+	minutes := make(map[minuteKey]*minuteStats)
+	for f := range flows {
+		k := minuteKey{
+			Minute:      f.Start - f.Start%60,
+			InterfaceID: f.InterfaceID,
+			Direction:   f.Direction,
+			Action:      f.Action,
+			Source:      f.Source,
+			Destination: f.Destination,
+			DstPort:     f.DstPort,
+			Protocol:    f.Protocol,
+			AwsService:  f.AwsService,
+		}
+		if _, exists := minutes[k]; !exists {
+			minutes[k] = &minuteStats{}
+		}
+		minutes[k].Packets += f.Packets
+		minutes[k].Bytes += f.Bytes
+		minutes[k].Flows++
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO flows_by_minute VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("prepare flows_by_minute: %w", err)
+	}
+	defer stmt.Close()
+
+	for k, s := range minutes {
+		if _, err := stmt.Exec(date, region, k.Minute, k.InterfaceID, k.Direction, k.Action, k.Source, k.Destination,
+			k.DstPort, k.Protocol, k.AwsService, s.Packets, s.Bytes, s.Flows); err != nil {
+			return fmt.Errorf("insert flows_by_minute: %w", err)
+		}
+	}
+	return nil
+}
+
+func insertTable(tx *sql.Tx, t report.Table) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(t.Columns)), ", ")
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", t.Name, strings.Join(t.Columns, ", "), placeholders))
+	if err != nil {
+		return fmt.Errorf("prepare %s: %w", t.Name, err)
+	}
+	defer stmt.Close()
+
+	for _, row := range t.Rows {
+		if _, err := stmt.Exec(row...); err != nil {
+			return fmt.Errorf("insert %s: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// Column types of the aggregate tables, anything not listed is TEXT
+var columnTypes = map[string]string{
+	"bytes":                     "INTEGER",
+	"baseline_bytes":            "INTEGER",
+	"mad_bytes":                 "INTEGER",
+	"threshold_bytes":           "INTEGER",
+	"connection_num":            "INTEGER",
+	"history_days":              "INTEGER",
+	"port":                      "INTEGER",
+	"number":                    "INTEGER",
+	"unix":                      "INTEGER",
+	"cross_region":              "INTEGER",
+	"gb":                        "REAL",
+	"cost_usd":                  "REAL",
+	"gb_per_month":              "REAL",
+	"nat_cost_monthly_usd":      "REAL",
+	"endpoint_cost_monthly_usd": "REAL",
+	"net_savings_monthly_usd":   "REAL",
+	"score":                     "REAL",
+	"value":                     "REAL",
+	"threshold":                 "REAL",
+}
+
+// createTable declares an aggregate table and indexes it on (date, region)
+func createTable(t report.Table) string {
+	cols := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		typ, ok := columnTypes[c]
+		if !ok {
+			typ = "TEXT"
+		}
+		cols[i] = c + " " + typ
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s);\nCREATE INDEX IF NOT EXISTS %s_run ON %s (date, region);",
+		t.Name, strings.Join(cols, ", "), t.Name, t.Name)
+}
+
+func tableNames(tables []report.Table) []string {
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = t.Name
+	}
+	return names
+}
+
+// extraTables flattens the parts of result.json that are not exported as CSV
+func extraTables(r report.Report) []report.Table {
+	date := r.Date()
+
+	recommendations := report.Table{
+		Name:    "recommendations",
+		Columns: []string{"date", "region", "service", "service_region", "cross_region", "endpoint_type", "endpoint_services", "gb_per_month", "nat_cost_monthly_usd", "endpoint_cost_monthly_usd", "net_savings_monthly_usd", "note"},
+	}
+	for _, e := range r.Recommendations {
+		recommendations.Rows = append(recommendations.Rows, []any{date, r.Region, e.Service, e.Region, e.CrossRegion, e.EndpointType, strings.Join(e.EndpointServices, ";"),
+			e.GBPerMonth, e.NatCostMonthlyUSD, e.EndpointCostMonthlyUSD, e.NetSavingsMonthlyUSD, e.Note})
+	}
+
+	anomalies := report.Table{
+		Name:    "anomalies",
+		Columns: []string{"date", "region", "kind", "key", "reason", "bytes", "baseline_bytes", "mad_bytes", "threshold_bytes", "score", "history_days"},
+	}
+	for _, e := range r.Anomalies {
+		anomalies.Rows = append(anomalies.Rows, []any{date, r.Region, e.Kind, e.Key, e.Reason, e.Bytes, e.BaselineBytes, e.MADBytes, e.ThresholdBytes, e.Score, e.HistoryDays})
+	}
+
+	violations := report.Table{
+		Name:    "budget_violations",
+		Columns: []string{"date", "region", "budget", "key", "level", "value", "threshold", "unit"},
+	}
+	for _, e := range r.BudgetViolations {
+		violations.Rows = append(violations.Rows, []any{date, r.Region, e.Budget, e.Key, e.Level, e.Value, e.Threshold, e.Unit})
+	}
+
+	return []report.Table{recommendations, anomalies, violations}
+}
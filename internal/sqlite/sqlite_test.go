@@ -0,0 +1,126 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"vpc_flowlogs_egress_analyzer/internal/report"
+)
+
+func testReport(day string) report.Report {
+	return report.Report{
+		Year: "2025", Month: "12", Day: day, Region: "eu-west-3",
+		Total:      report.Total{Bytes: 1 << 30, GB: 1, CostUSD: 0.045},
+		EgressByIP: []report.IPEntry{{IP: "8.8.8.8", Bytes: 1 << 30, GB: 1, CostUSD: 0.045}},
+	}
+}
+
+func exec(t *testing.T, path, query string) {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(query); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+func queryInt(t *testing.T, path, query string) int {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow(query).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+func TestWriteRecordsSchemaVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "egress.sqlite")
+
+	for _, day := range []string{"01", "02", "02"} {
+		if err := Write(path, testReport(day), nil, FlowsNone); err != nil {
+			t.Fatalf("write %s: %v", day, err)
+		}
+	}
+	if v := queryInt(t, path, "PRAGMA user_version"); v != schemaVersion {
+		t.Fatalf("user_version %d, expected %d", v, schemaVersion)
+	}
+	if n := queryInt(t, path, "SELECT count(*) FROM egress_by_destination"); n != 2 {
+		t.Fatalf("%d destination rows, expected one per day", n)
+	}
+}
+
+func TestWriteRefusesOtherSchemas(t *testing.T) {
+	cases := []struct {
+		name    string
+		prepare func(t *testing.T, path string)
+		err     string
+	}{
+		{
+			name: "newer version",
+			prepare: func(t *testing.T, path string) {
+				if err := Write(path, testReport("01"), nil, FlowsNone); err != nil {
+					t.Fatalf("write: %v", err)
+				}
+				exec(t, path, fmt.Sprintf("PRAGMA user_version = %d", schemaVersion+1))
+			},
+			err: "schema version",
+		},
+		{
+			name: "unversioned with other columns",
+			prepare: func(t *testing.T, path string) {
+				exec(t, path, "CREATE TABLE egress_by_destination (date TEXT, region TEXT, ip TEXT, bytes INTEGER)")
+			},
+			err: "table egress_by_destination has columns",
+		},
+		{
+			name: "current version with reordered columns",
+			prepare: func(t *testing.T, path string) {
+				exec(t, path, "CREATE TABLE runs (region TEXT NOT NULL, date TEXT NOT NULL, cost_per_gb_usd REAL, bytes INTEGER, gb REAL, cost_usd REAL, written_at TEXT)")
+				exec(t, path, fmt.Sprintf("PRAGMA user_version = %d", schemaVersion))
+			},
+			err: "table runs has columns",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "egress.sqlite")
+			c.prepare(t, path)
+			tables := queryInt(t, path, "SELECT count(*) FROM sqlite_master")
+			version := queryInt(t, path, "PRAGMA user_version")
+
+			err := Write(path, testReport("02"), nil, FlowsNone)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Fatalf("expected an error about %q, got %v", c.err, err)
+			}
+			if queryInt(t, path, "SELECT count(*) FROM sqlite_master") != tables || queryInt(t, path, "PRAGMA user_version") != version {
+				t.Fatalf("a refused database was altered")
+			}
+		})
+	}
+}
+
+func TestWriteAdoptsUnversionedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "egress.sqlite")
+	if err := Write(path, testReport("01"), nil, FlowsNone); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	// As written before the version was recorded
+	exec(t, path, "PRAGMA user_version = 0")
+
+	if err := Write(path, testReport("02"), nil, FlowsNone); err != nil {
+		t.Fatalf("write to an unversioned database with the same columns: %v", err)
+	}
+	if v := queryInt(t, path, "PRAGMA user_version"); v != schemaVersion {
+		t.Fatalf("user_version %d, expected %d", v, schemaVersion)
+	}
+}
@@ -0,0 +1,261 @@
+package tui
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"vpc_flowlogs_egress_analyzer/internal/report"
+)
+
+type row struct {
+	cells []string
+	ip    net.IP // nil when the row is not an address
+	asn   string
+	bytes int
+	cost  float64
+	flows int
+	drill func() *frame
+}
+
+type frame struct {
+	title   string
+	columns []string
+	rows    []row
+	filter  string
+	visible []row
+	cursor  int
+	offset  int
+}
+
+const (
+	sortBytes = "bytes"
+	sortCost  = "cost"
+	sortFlows = "flows"
+)
+
+// index gives the drill-down views access to the report without rescanning it
+type index struct {
+	rep  *report.Report
+	byIP map[string]report.IPEntry
+}
+
+func newIndex(r *report.Report) *index {
+	idx := &index{rep: r, byIP: make(map[string]report.IPEntry, len(r.EgressByIP))}
+	for _, e := range r.EgressByIP {
+		idx.byIP[e.IP] = e
+	}
+	return idx
+}
+
+func (idx *index) destinationRow(e report.IPEntry) row {
+	name, asn, asName := "", "", ""
+	if e.Hostname != nil {
+		name = e.Hostname.Hostname
+	}
+	if e.IpInfo != nil {
+		asn, asName = e.IpInfo.ASN, e.IpInfo.AS_NAME
+	}
+	ip := e.IP
+	return row{
+		cells: []string{ip, e.AwsService, name, strings.TrimSpace(asn + " " + asName)},
+		ip:    net.ParseIP(ip),
+		asn:   asn,
+		bytes: e.Bytes, cost: e.CostUSD, flows: e.ConnectionNum,
+		drill: func() *frame { return idx.sourcesOf(ip) },
+	}
+}
+
+var destinationColumns = []string{"Destination", "AWS service", "Hostname", "ASN"}
+
+func (idx *index) destinations() *frame {
+	f := &frame{title: "Destinations", columns: destinationColumns}
+	for _, e := range idx.rep.EgressByIP {
+		f.rows = append(f.rows, idx.destinationRow(e))
+	}
+	return f
+}
+
+func (idx *index) sources() *frame {
+	f := &frame{title: "Sources", columns: []string{"Source", "Interface"}}
+	for _, e := range idx.rep.EgressBySource {
+		src := e.Source
+		f.rows = append(f.rows, row{
+			cells: []string{src, e.InterfaceID},
+			ip:    net.ParseIP(src),
+			bytes: e.Bytes, cost: e.CostUSD, flows: e.ConnectionNum,
+			drill: func() *frame { return idx.destinationsOf(src) },
+		})
+	}
+	return f
+}
+
+func (idx *index) services() *frame {
+	f := &frame{title: "AWS services", columns: []string{"Service", "Region", "Cross-region"}}
+	for _, e := range idx.rep.EgressByAwsService {
+		service, region := e.Service, e.Region
+		cross := ""
+		if e.CrossRegion {
+			cross = "yes"
+		}
+		f.rows = append(f.rows, row{
+			cells: []string{service, region, cross},
+			bytes: e.Bytes, cost: e.CostUSD, flows: e.ConnectionNum,
+			drill: func() *frame { return idx.destinationsOfService(service, region) },
+		})
+	}
+	return f
+}
+
+func (idx *index) ports() *frame {
+	f := &frame{title: "Ports", columns: []string{"Port", "Service"}}
+	for _, e := range idx.rep.EgressByPort {
+		port := e.Port
+		f.rows = append(f.rows, row{
+			cells: []string{fmt.Sprint(port), e.Service},
+			bytes: e.Bytes, cost: e.CostUSD, flows: e.ConnectionNum,
+			drill: func() *frame { return idx.destinationsOnPort(port) },
+		})
+	}
+	return f
+}
+
+// sourcesOf and destinationsOf rely on egress_by_pair, which is capped at PAIR_TOP_N
+func (idx *index) sourcesOf(destination string) *frame {
+	f := &frame{title: "Sources → " + destination, columns: []string{"Source", "Interface"}}
+	for _, p := range idx.rep.EgressByPair {
+		if p.Destination != destination {
+			continue
+		}
+		src := p.Source
+		f.rows = append(f.rows, row{
+			cells: []string{src, p.InterfaceID},
+			ip:    net.ParseIP(src),
+			bytes: p.Bytes, cost: p.CostUSD, flows: p.ConnectionNum,
+			drill: func() *frame { return idx.destinationsOf(src) },
+		})
+	}
+	return f
+}
+
+func (idx *index) destinationsOf(source string) *frame {
+	f := &frame{title: "Destinations ← " + source, columns: []string{"Destination", "AWS service", "Hostname", "ASN", "Interface"}}
+	for _, p := range idx.rep.EgressByPair {
+		if p.Source != source {
+			continue
+		}
+		e, ok := idx.byIP[p.Destination]
+		if !ok {
+			e = report.IPEntry{IP: p.Destination, AwsService: p.AwsService}
+		}
+		r := idx.destinationRow(e)
+		r.cells = append(r.cells, p.InterfaceID)
+		r.bytes, r.cost, r.flows = p.Bytes, p.CostUSD, p.ConnectionNum
+		f.rows = append(f.rows, r)
+	}
+	return f
+}
+
+func (idx *index) destinationsOfService(service, region string) *frame {
+	title := "Destinations of " + service
+	if region != "" {
+		title += " (" + region + ")"
+	}
+	f := &frame{title: title, columns: destinationColumns}
+	for _, e := range idx.rep.EgressByIP {
+		if e.AwsService == service && e.AwsRegion == region {
+			f.rows = append(f.rows, idx.destinationRow(e))
+		}
+	}
+	return f
+}
+
+// destinationsOnPort only sees the top ports kept per destination in result.json
+func (idx *index) destinationsOnPort(port int) *frame {
+	f := &frame{title: fmt.Sprintf("Destinations on port %d", port), columns: destinationColumns}
+	for _, e := range idx.rep.EgressByIP {
+		for _, p := range e.TopPorts {
+			if p.Port != port {
+				continue
+			}
+			r := idx.destinationRow(e)
+			r.bytes, r.cost, r.flows = p.Bytes, p.CostUSD, p.ConnectionNum
+			f.rows = append(f.rows, r)
+		}
+	}
+	return f
+}
+
+// refresh applies the frame's filter and the sort order, keeping the cursor in range
+func (f *frame) refresh(sortBy string) {
+	match := matcher(f.filter)
+	f.visible = f.visible[:0]
+	for _, r := range f.rows {
+		if match(r) {
+			f.visible = append(f.visible, r)
+		}
+	}
+
+	sort.SliceStable(f.visible, func(i, j int) bool {
+		a, b := f.visible[i], f.visible[j]
+		switch sortBy {
+		case sortCost:
+			return a.cost > b.cost
+		case sortFlows:
+			return a.flows > b.flows
+		default:
+			return a.bytes > b.bytes
+		}
+	})
+
+	if f.cursor >= len(f.visible) {
+		f.cursor = max(len(f.visible)-1, 0)
+	}
+}
+
+// matcher understands a CIDR or IP, an ASN (AS16509), or falls back to a case-insensitive
+// substring of any column. Bare digits match the ASN or a substring, as they may be part of
+// an IP or a port as well.
+func matcher(filter string) func(row) bool {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return func(row) bool { return true }
+	}
+
+	if _, cidr, err := net.ParseCIDR(filter); err == nil {
+		return func(r row) bool { return r.ip != nil && cidr.Contains(r.ip) }
+	}
+	if ip := net.ParseIP(filter); ip != nil {
+		return func(r row) bool { return r.ip != nil && r.ip.Equal(ip) }
+	}
+
+	if isASN(filter) {
+		return func(r row) bool { return strings.EqualFold(r.asn, filter) }
+	}
+
+	needle := strings.ToLower(filter)
+	contains := func(r row) bool {
+		for _, c := range r.cells {
+			if strings.Contains(strings.ToLower(c), needle) {
+				return true
+			}
+		}
+		return false
+	}
+	if asn := "AS" + filter; isASN(asn) {
+		return func(r row) bool { return strings.EqualFold(r.asn, asn) || contains(r) }
+	}
+	return contains
+}
+
+func isASN(s string) bool {
+	if len(s) <= 2 || !strings.EqualFold(s[:2], "AS") {
+		return false
+	}
+	for _, c := range s[2:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,272 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"vpc_flowlogs_egress_analyzer/internal/report"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const maxCellWidth = 40
+
+var (
+	titleStyle    = lipgloss.NewStyle().Bold(true)
+	tabStyle      = lipgloss.NewStyle().Padding(0, 1)
+	activeStyle   = tabStyle.Reverse(true)
+	headerStyle   = lipgloss.NewStyle().Bold(true).Underline(true)
+	selectedStyle = lipgloss.NewStyle().Reverse(true)
+	helpStyle     = lipgloss.NewStyle().Faint(true)
+)
+
+type model struct {
+	rep       *report.Report
+	views     []func() *frame
+	view      int
+	stack     []*frame
+	sortBy    string
+	filtering bool
+	input     string
+	width     int
+	height    int
+}
+
+// Run opens the interactive explorer on a loaded result
+func Run(r *report.Report) error {
+	idx := newIndex(r)
+	m := &model{
+		rep:    r,
+		views:  []func() *frame{idx.destinations, idx.sources, idx.services, idx.ports},
+		sortBy: sortBytes,
+		height: 24,
+	}
+	m.open(0)
+
+	if _, err := tea.NewProgram(m, tea.WithAltScreen()).Run(); err != nil {
+		return fmt.Errorf("tui: %w", err)
+	}
+	return nil
+}
+
+func (m *model) open(view int) {
+	m.view = view
+	m.stack = []*frame{m.views[view]()}
+	m.current().refresh(m.sortBy)
+}
+
+func (m *model) current() *frame {
+	return m.stack[len(m.stack)-1]
+}
+
+func (m *model) Init() tea.Cmd {
+	return nil
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case tea.KeyMsg:
+		if m.filtering {
+			m.updateFilter(msg)
+			return m, nil
+		}
+		return m, m.updateKeys(msg)
+	}
+	return m, nil
+}
+
+func (m *model) updateFilter(msg tea.KeyMsg) {
+	f := m.current()
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.filtering = false
+	case tea.KeyEsc:
+		m.filtering = false
+		m.input = f.filter
+		return
+	case tea.KeyBackspace:
+		if len(m.input) > 0 {
+			m.input = m.input[:len(m.input)-1]
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.input += string(msg.Runes)
+	}
+	f.filter = m.input
+	f.cursor, f.offset = 0, 0
+	f.refresh(m.sortBy)
+}
+
+func (m *model) updateKeys(msg tea.KeyMsg) tea.Cmd {
+	f := m.current()
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return tea.Quit
+	case "up", "k":
+		f.cursor = max(f.cursor-1, 0)
+	case "down", "j":
+		f.cursor = min(f.cursor+1, max(len(f.visible)-1, 0))
+	case "pgup":
+		f.cursor = max(f.cursor-m.pageSize(), 0)
+	case "pgdown":
+		f.cursor = min(f.cursor+m.pageSize(), max(len(f.visible)-1, 0))
+	case "home", "g":
+		f.cursor = 0
+	case "end", "G":
+		f.cursor = max(len(f.visible)-1, 0)
+	case "1", "2", "3", "4":
+		m.open(int(msg.String()[0] - '1'))
+	case "tab":
+		m.open((m.view + 1) % len(m.views))
+	case "shift+tab":
+		m.open((m.view + len(m.views) - 1) % len(m.views))
+	case "b":
+		m.setSort(sortBytes)
+	case "c":
+		m.setSort(sortCost)
+	case "f":
+		m.setSort(sortFlows)
+	case "/":
+		m.filtering = true
+		m.input = f.filter
+	case "enter", "right", "l":
+		if len(f.visible) > 0 && f.visible[f.cursor].drill != nil {
+			next := f.visible[f.cursor].drill()
+			next.refresh(m.sortBy)
+			m.stack = append(m.stack, next)
+		}
+	case "esc", "left", "h", "backspace":
+		if f.filter != "" && msg.String() == "esc" {
+			f.filter = ""
+			f.refresh(m.sortBy)
+		} else if len(m.stack) > 1 {
+			m.stack = m.stack[:len(m.stack)-1]
+			m.current().refresh(m.sortBy)
+		}
+	}
+	return nil
+}
+
+func (m *model) setSort(by string) {
+	m.sortBy = by
+	m.current().refresh(by)
+}
+
+// pageSize is the number of table rows left once header and footer lines are drawn
+func (m *model) pageSize() int {
+	return max(m.height-8, 1)
+}
+
+func (m *model) View() string {
+	var b strings.Builder
+	f := m.current()
+
+	fmt.Fprintf(&b, "%s  %s  $%.2f for %.2f GB\n",
+		titleStyle.Render("📊 VPC egress "+m.rep.Date()), m.rep.Region, m.rep.Total.CostUSD, m.rep.Total.GB)
+
+	tabs := make([]string, len(m.views))
+	for i, name := range []string{"Destinations", "Sources", "AWS services", "Ports"} {
+		label := fmt.Sprintf("%d %s", i+1, name)
+		if i == m.view {
+			tabs[i] = activeStyle.Render(label)
+		} else {
+			tabs[i] = tabStyle.Render(label)
+		}
+	}
+	b.WriteString(strings.Join(tabs, "") + "\n")
+
+	crumbs := make([]string, len(m.stack))
+	for i, s := range m.stack {
+		crumbs[i] = s.title
+	}
+	status := fmt.Sprintf("%s · %d/%d rows · sort: %s", strings.Join(crumbs, " › "), len(f.visible), len(f.rows), m.sortBy)
+	if m.filtering {
+		status += " · filter: " + m.input + "▏"
+	} else if f.filter != "" {
+		status += " · filter: " + f.filter
+	}
+	b.WriteString(status + "\n\n")
+
+	m.writeTable(&b, f)
+
+	help := "↑/↓ move · enter drill down · esc back · tab/1-4 views · b/c/f sort by bytes/cost/flows · / filter (CIDR, ASN, text) · q quit"
+	if m.filtering {
+		help = "type a CIDR, IP, ASN (AS16509) or text · enter apply · esc cancel"
+	}
+	b.WriteString("\n" + helpStyle.Render(help))
+	return b.String()
+}
+
+func (m *model) writeTable(b *strings.Builder, f *frame) {
+	columns := append(append([]string{}, f.columns...), "GB", "Cost USD", "Flows", "Share")
+
+	cells := make([][]string, len(f.visible))
+	for i, r := range f.visible {
+		share := 0.0
+		if m.rep.Total.Bytes > 0 {
+			share = float64(r.bytes) / float64(m.rep.Total.Bytes) * 100
+		}
+		cells[i] = append(append([]string{}, r.cells...),
+			fmt.Sprintf("%.2f", bytesToGB(r.bytes)), fmt.Sprintf("%.2f", r.cost), fmt.Sprint(r.flows), fmt.Sprintf("%.1f%%", share))
+	}
+
+	widths := make([]int, len(columns))
+	for i, c := range columns {
+		widths[i] = lipgloss.Width(c)
+	}
+	for _, row := range cells {
+		for i, c := range row {
+			widths[i] = min(max(widths[i], lipgloss.Width(c)), maxCellWidth)
+		}
+	}
+
+	metrics := len(f.columns)
+	format := func(values []string) string {
+		out := make([]string, len(values))
+		for i, v := range values {
+			v = truncate(v, widths[i])
+			pad := strings.Repeat(" ", widths[i]-lipgloss.Width(v))
+			if i >= metrics {
+				out[i] = pad + v
+			} else {
+				out[i] = v + pad
+			}
+		}
+		return strings.Join(out, "  ")
+	}
+
+	b.WriteString(headerStyle.Render(format(columns)) + "\n")
+
+	page := m.pageSize()
+	if f.cursor < f.offset {
+		f.offset = f.cursor
+	} else if f.cursor >= f.offset+page {
+		f.offset = f.cursor - page + 1
+	}
+	for i := f.offset; i < len(cells) && i < f.offset+page; i++ {
+		line := format(cells[i])
+		if i == f.cursor {
+			line = selectedStyle.Render(line)
+		}
+		b.WriteString(line + "\n")
+	}
+	if len(cells) == 0 {
+		b.WriteString(helpStyle.Render("no rows") + "\n")
+	}
+}
+
+func truncate(s string, width int) string {
+	if lipgloss.Width(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 && lipgloss.Width(string(r)) > width-1 {
+		r = r[:len(r)-1]
+	}
+	return string(r) + "…"
+}
+
+func bytesToGB(b int) float64 {
+	return float64(b) / (1024 * 1024 * 1024)
+}